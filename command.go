@@ -0,0 +1,204 @@
+package gogetopt
+
+import (
+	"errors"
+	"strings"
+)
+
+// Add a command to the parser, for programs run as "tool <command> [options] [args]".  The command is
+// a Parser of its own: register its options on the returned parser, and add commands to it for a
+// deeper tree.  When parsing, the first non-option argument names the command, and everything after
+// it is parsed by the command.  Persistent options (see SetPersistent()) from this parser and its
+// parents work in the command as well.
+//
+// The handler is run by Run() when the command is chosen, and is passed the command's parser so it
+// can read the command's options and args.  It can be nil for commands which only hold other commands.
+func (p *Parser) AddCommand(name, usage string, handler func(*Parser) error) (*Parser, error) {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return nil, errors.New(ERR_NO_CMD + name)
+	}
+
+	_, exists := p.commands[name]
+	if exists {
+		return nil, errors.New(ERR_CMD_ALREADY_EXISTS + name)
+	}
+
+	cmd := NewParser()
+	cmd.name = name
+	cmd.cmdUsage = usage
+	cmd.parent = p
+	cmd.handler = handler
+
+	p.commands[name] = cmd
+	p.commandOrder = append(p.commandOrder, cmd)
+	return cmd, nil
+}
+
+// Make an option persistent, so it can be used by every command under the parser as well, like a
+// global --verbose.  Its value is kept by this parser no matter which command it was given to, so
+// GetBool() and friends work for it on this parser or any command under it.
+func (p *Parser) SetPersistent(key string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.persistent = true
+	return nil
+}
+
+// Parse the command line and run the handler of the command that was chosen.  See RunArgs().
+func (p *Parser) Run() error {
+	p.Parse()
+	return p.dispatch()
+}
+
+// Parse an argument list and run the handler of the command that was chosen.  A parse error is
+// returned without running anything.  Otherwise the deepest command chosen has its handler run, and
+// whatever the handler returns is returned.  If no command was chosen, or it has no handler, nothing
+// is run and the result is nil - check GetCommand() to tell.
+func (p *Parser) RunArgs(args []string) error {
+	p.ParseArgs(args)
+	return p.dispatch()
+}
+
+// Get the command chosen by the last parse, or nil if there wasn't one.  This is only the command
+// directly under this parser - call GetCommand() on it to go further down.
+func (p *Parser) GetCommand() *Parser {
+	return p.command
+}
+
+// Get a command's name, or "" for a parser which isn't a command.
+func (p *Parser) GetName() string {
+	return p.name
+}
+
+// Get the names of the commands leading to this one, space separated ("remote add"), or "" for a
+// parser which isn't a command.
+func (p *Parser) GetCommandPath() string {
+	names := make([]string, 0)
+	for q := p; q.parent != nil; q = q.parent {
+		names = append([]string{q.name}, names...)
+	}
+	return strings.Join(names, " ")
+}
+
+// Add a command to the default parser.  See Parser.AddCommand().
+func AddCommand(name, usage string, handler func(*Parser) error) (*Parser, error) {
+	return defaultParser.AddCommand(name, usage, handler)
+}
+
+// Make an option on the default parser persistent.  See Parser.SetPersistent().
+func SetPersistent(key string) error {
+	return defaultParser.SetPersistent(key)
+}
+
+// Parse the command line with the default parser and run the chosen command.  See Parser.Run().
+func Run() error {
+	return defaultParser.Run()
+}
+
+// Parse an argument list with the default parser and run the chosen command.  See Parser.RunArgs().
+func RunArgs(args []string) error {
+	return defaultParser.RunArgs(args)
+}
+
+// Get the command chosen on the default parser.  See Parser.GetCommand().
+func GetCommand() *Parser {
+	return defaultParser.GetCommand()
+}
+
+//
+// Helpers
+//
+
+// Run the handler for the deepest command chosen by the last parse
+func (p *Parser) dispatch() error {
+	if p.HasError() {
+		return p.GetError()
+	}
+
+	cmd := p
+	for cmd.command != nil {
+		cmd = cmd.command
+	}
+
+	if cmd == p || cmd.handler == nil {
+		return nil
+	}
+	return cmd.handler(cmd)
+}
+
+// Find the option for a short key, including persistent options from parent parsers.  The parser's
+// own options win over its parents'.  Returns nil if there's no such option.
+func (p *Parser) findShort(short string) *opt {
+	o, ok := p.shortKeys[short]
+	if ok {
+		return o
+	}
+
+	for a := p.parent; a != nil; a = a.parent {
+		o, ok = a.shortKeys[short]
+		if ok && isPersistent(o) {
+			return o
+		}
+	}
+	return nil
+}
+
+// Get every long key the parser accepts, including persistent options from parent parsers.  The
+// parser's own options win over its parents'.
+func (p *Parser) visibleLongKeys() map[string]*opt {
+	if p.parent == nil {
+		return p.longKeys
+	}
+
+	longKeys := make(map[string]*opt)
+	for a := p; a != nil; a = a.parent {
+		for long, o := range a.longKeys {
+			_, taken := longKeys[long]
+			if !taken && (a == p || isPersistent(o)) {
+				longKeys[long] = o
+			}
+		}
+	}
+	return longKeys
+}
+
+// Get the persistent options this parser takes from its parents, closest parent first
+func (p *Parser) inheritedOpts() []*opt {
+	inherited := make([]*opt, 0)
+	for a := p.parent; a != nil; a = a.parent {
+		for _, o := range a.order {
+			if o.persistent {
+				inherited = append(inherited, o)
+			}
+		}
+	}
+	return inherited
+}
+
+// Find the parser which keeps the value for an option key.  That's this parser for its own options,
+// or a parent for a persistent option it owns.
+func (p *Parser) ownerOf(key string) *Parser {
+	_, ok := p.opts[key]
+	if ok {
+		return p
+	}
+
+	for a := p.parent; a != nil; a = a.parent {
+		o, ok := a.opts[key]
+		if ok && o.persistent {
+			return a
+		}
+	}
+	return p
+}
+
+// Check if an option is persistent, including the --no-<long> stand-ins of persistent switches
+func isPersistent(o *opt) bool {
+	if o.negates != nil {
+		return o.negates.persistent
+	}
+	return o.persistent
+}
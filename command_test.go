@@ -0,0 +1,155 @@
+package gogetopt
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Build a small command tree: tool [-v] deploy [--env ENV] [--dry-run] args, tool remote add NAME
+func buildTestCommands(t *testing.T) (root, deploy, remote, add *Parser, ran *string) {
+	var err error
+	ran = new(string)
+	root = NewParser()
+
+	err = root.RegisterOpt("verbose", "verbose", "v", true, false, "test usage")
+	err = root.RegisterOpt("config", "config", "c", false, false, "test usage")
+	if err != nil {
+		t.Fatal("Command test: Got reg error: " + err.Error())
+	}
+
+	if err = root.SetPersistent("verbose"); err != nil {
+		t.Fatal("SetPersistent() failed: " + err.Error())
+	}
+
+	deploy, err = root.AddCommand("deploy", "Deploy the app", func(cmd *Parser) error {
+		*ran = "deploy " + cmd.GetString("env") + " " + strings.Join(cmd.GetArgs(), ",")
+		return nil
+	})
+	if err != nil {
+		t.Fatal("AddCommand() failed: " + err.Error())
+	}
+
+	err = deploy.RegisterOpt("env", "env", "e", false, true, "test usage")
+	err = deploy.RegisterOpt("dryrun", "dry-run", "n", true, false, "test usage")
+	if err != nil {
+		t.Fatal("Command test: Got reg error: " + err.Error())
+	}
+
+	remote, err = root.AddCommand("remote", "Manage remotes", nil)
+	if err != nil {
+		t.Fatal("AddCommand() failed: " + err.Error())
+	}
+
+	add, err = remote.AddCommand("add", "Add a remote", func(cmd *Parser) error {
+		return errors.New("add failed")
+	})
+	if err != nil {
+		t.Fatal("AddCommand() failed: " + err.Error())
+	}
+
+	return
+}
+
+// Commands get their own options plus persistent ones from their parents
+func TestCommands(t *testing.T) {
+	root, deploy, _, _, ran := buildTestCommands(t)
+
+	if _, err := root.AddCommand("deploy", "again", nil); err == nil {
+		t.Error("AddCommand() didn't fail for a command name which was already used")
+	}
+
+	err := root.RunArgs([]string{"-c", "tool.conf", "deploy", "-vn", "--env=prod", "first", "second"})
+	if err != nil {
+		t.Error("RunArgs() failed: " + err.Error())
+	}
+
+	if *ran != "deploy prod first,second" {
+		t.Error("Command test: Handler didn't run with the right values.  Got: " + *ran)
+	}
+
+	if root.GetCommand() != deploy || deploy.GetCommandPath() != "deploy" {
+		t.Error("Command test: The wrong command was reported as chosen")
+	}
+
+	// Persistent values are kept by their owner and visible from the command
+	if !root.GetBool("verbose") || !deploy.GetBool("verbose") || !deploy.GetBool("dryrun") {
+		t.Error("Command test: Didn't get a positive boolean when expecting one")
+	}
+
+	if root.GetString("config") != "tool.conf" || len(root.GetArgs()) != 0 {
+		t.Error("Command test: Options before the command weren't kept by the root")
+	}
+
+	// Root options which aren't persistent don't work in the command
+	root.ParseArgs([]string{"deploy", "--env", "prod", "--config", "x"})
+	if !root.HasError() {
+		t.Error("Command test: A non-persistent option worked in a command")
+	}
+
+	// Unknown commands
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_NO_CMD+"destroy") + "$")
+	root.ParseArgs([]string{"destroy"})
+	if !root.HasError() || !expr.MatchString(root.GetError().Error()) {
+		t.Errorf("Command test: Didn't get the right error for an unknown command, got: %v", root.GetError())
+	}
+
+	// A fresh parse forgets the last command
+	root.ParseArgs([]string{"-v"})
+	if root.HasError() || root.GetCommand() != nil || deploy.GetString("env") != "" {
+		t.Error("Command test: Results from the last command were kept")
+	}
+}
+
+// Nested commands, handler errors and missing required options
+func TestNestedCommands(t *testing.T) {
+	root, _, remote, add, _ := buildTestCommands(t)
+
+	err := root.RunArgs([]string{"remote", "add", "-v", "origin"})
+	if err == nil || err.Error() != "add failed" {
+		t.Errorf("Command test: Didn't get the handler's error, got: %v", err)
+	}
+
+	if root.GetCommand() != remote || remote.GetCommand() != add || add.GetCommandPath() != "remote add" {
+		t.Error("Command test: The wrong command was reported as chosen")
+	}
+
+	if !add.GetBool("verbose") || len(add.GetArgs()) != 1 || add.GetArgs()[0] != "origin" {
+		t.Error("Command test: Nested command didn't get the right options and args")
+	}
+
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_REQ+"-e or --env (for command: deploy)") + "$")
+	err = root.RunArgs([]string{"deploy"})
+	if err == nil || !expr.MatchString(err.Error()) {
+		t.Errorf("Command test: Didn't get the right error for a command's required option, got: %v", err)
+	}
+
+	// A terminator after a command can be found from the top, for passing the rest along
+	root.ParseArgs([]string{"remote", "add", "-v", "--", "origin", "-x"})
+	for _, parser := range []*Parser{root, remote, add} {
+		rest := parser.GetArgsAfterTerminator()
+		if parser.GetTerminatorIndex() != 3 || len(rest) != 2 || rest[0] != "origin" || rest[1] != "-x" {
+			t.Errorf("Command test: Wrong terminator for %q.  Got: %d, %+v", parser.GetCommandPath(), parser.GetTerminatorIndex(), rest)
+		}
+	}
+
+	if len(root.GetArgs()) != 0 || len(add.GetArgs()) != 2 {
+		t.Errorf("Command test: Args after a command's terminator went to the wrong parser.  Got: %+v, %+v", root.GetArgs(), add.GetArgs())
+	}
+}
+
+// Command usage includes inherited options, and parents list their commands
+func TestCommandUsage(t *testing.T) {
+	root, deploy, _, _, _ := buildTestCommands(t)
+
+	usage := root.GetUsage()
+	if !strings.Contains(usage, "Commands:") || !regexp.MustCompile(`\n  deploy +Deploy the app\n`).MatchString(usage) {
+		t.Error("GetUsage() test: Commands weren't listed.  Got: " + usage)
+	}
+
+	usage = deploy.GetUsage()
+	if !strings.Contains(usage, "--env") || !strings.Contains(usage, "--verbose") || strings.Contains(usage, "--config") {
+		t.Error("GetUsage() test: Command usage didn't have the right options.  Got: " + usage)
+	}
+}
@@ -0,0 +1,827 @@
+package gogetopt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// What shell completion offers for an option's value
+type CompletionKind int
+
+const (
+	// Nothing is offered, the value has to be typed
+	COMPLETE_NONE CompletionKind = iota
+
+	// File and directory names
+	COMPLETE_FILE
+
+	// Directory names only
+	COMPLETE_DIR
+
+	// Whatever the option's CompletionFunc says, asked for at completion time.  Set by
+	// SetCompletionFunc().
+	completeDynamic CompletionKind = -1
+)
+
+const (
+	ERR_UNKNOWN_SHELL string = "Can't generate completion for shell: "
+
+	// The hidden first argument completion scripts run the program with, see HandleCompletion()
+	COMPLETE_ARG string = "__complete"
+)
+
+// A program's function for completing an option's value or a non-option argument, for things only
+// the program knows, like branch or cluster names.  It's passed the parser (or command) the word
+// belongs to, with everything before the word already parsed into it, and the part of the word typed
+// so far.  It returns the candidates, which don't need to be filtered by what was typed.
+type CompletionFunc func(p *Parser, partial string) []string
+
+// What Complete() is completing, and once the parse loop has found it, what sort of word it is
+type completion struct {
+	at      int
+	found   bool
+	slot    completionSlot
+	parser  *Parser
+	opt     *opt
+	prefix  string
+	partial string
+}
+
+type completionSlot int
+
+const (
+	// Nothing can be offered, like for a switch given a value with =
+	slotNone completionSlot = iota
+
+	// An option name, since the word starts with a dash
+	slotOptName
+
+	// An option's value, either after = or in the cluster, or as the whole word
+	slotValue
+
+	// A non-option argument, which is a command name for parsers with commands
+	slotArg
+)
+
+var (
+	// Anything which can't go in a shell function name
+	nonFuncChars = regexp.MustCompile("[^A-Za-z0-9_]")
+)
+
+// Set what completion offers for an option's value, for options which take a path.  By default
+// nothing is offered for values.
+func (p *Parser) SetCompletion(key string, kind CompletionKind) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.completion = kind
+	return nil
+}
+
+// Get a tab completion script for "bash", "zsh" or "fish".  The script completes option names, and
+// command names for parsers with commands, at whatever point in the command tree the line has got to.
+// After an option which takes a value it offers files or directories if SetCompletion() asked for
+// them, and nothing otherwise, rather than option names.  That goes for values after an = too, and
+// after a group of short options like -vo.  Hidden options aren't offered.
+//
+// The script is for the whole program, so it's the same whichever parser in the tree it's asked for.
+// It completes the program name set with SetProgName(), or the base name of os.Args[0].  To install it,
+// source the bash script from a bashrc or put it in the bash-completion directory, put the zsh script
+// in a directory on $fpath named "_<prog>", and put the fish script in ~/.config/fish/completions
+// named "<prog>.fish".
+func (p *Parser) GetCompletionScript(shell string) (string, error) {
+	root := p.root()
+	switch shell {
+	case "bash":
+		return root.bashCompletion(), nil
+	case "zsh":
+		return root.zshCompletion(), nil
+	case "fish":
+		return root.fishCompletion(), nil
+	}
+	return "", errors.New(ERR_UNKNOWN_SHELL + shell)
+}
+
+// Set a function which works out completions for an option's value when the user hits tab, for values
+// only the program can know.  The completion scripts from GetCompletionScript() run the program
+// to ask for them, see HandleCompletion().
+func (p *Parser) SetCompletionFunc(key string, fn CompletionFunc) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.completion = completeDynamic
+	o.completeFunc = fn
+	return nil
+}
+
+// Set a function which works out completions for the parser's non-option args, the same way as
+// SetCompletionFunc().  Parsers with commands complete command names instead.
+func (p *Parser) SetArgsCompletionFunc(fn CompletionFunc) {
+	p.argsCompleteFunc = fn
+}
+
+// Get the completions for a command line.  The last of the args is the word being completed, which
+// can be "".  The words before it are run through the same parsing as ParseArgs() to work out what
+// the last word is: an option name, an option's value (as its own word, after = or at the end of a
+// group of short options), a command name or a non-option argument.  Option and command names come
+// from the registered options and commands, and values and arguments from the CompletionFuncs.
+//
+// Candidates are the whole word, so the "--output=" or "-o" part is kept on values given that way.
+// Nothing is returned if the words before the last don't parse.  This replaces any results from a
+// previous parse.
+func (p *Parser) Complete(args []string) []string {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+
+	c := new(completion)
+	c.at = len(args) - 1
+	c.partial = args[c.at]
+
+	p.completing = c
+	p.ParseArgs(args)
+	for q := p; q != nil; q = q.command {
+		q.completing = nil
+	}
+
+	if !c.found {
+		return nil
+	}
+
+	candidates := make([]string, 0)
+	switch c.slot {
+	case slotOptName:
+		own, inherited := c.parser.shownOpts()
+		for _, o := range append(own, inherited...) {
+			candidates = append(candidates, optNames(o)...)
+			if o.negation != nil {
+				candidates = append(candidates, "--"+o.negation.long)
+			}
+		}
+
+	case slotValue:
+		if c.opt.completeFunc != nil {
+			candidates = c.opt.completeFunc(c.parser, c.partial)
+		}
+
+	case slotArg:
+		if len(c.parser.commandOrder) > 0 {
+			for _, cmd := range c.parser.commandOrder {
+				candidates = append(candidates, cmd.name)
+			}
+		} else if c.parser.argsCompleteFunc != nil {
+			candidates = c.parser.argsCompleteFunc(c.parser, c.partial)
+		}
+	}
+
+	matches := make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, c.partial) {
+			matches = append(matches, c.prefix+candidate)
+		}
+	}
+	return matches
+}
+
+// Answer a completion script.  If the program was run as "prog __complete <args>", this prints the
+// completions for the args to stdout, one per line, and returns true, and the program should exit
+// without doing anything else.  Otherwise it does nothing and returns false.  Call it before Parse():
+//
+//	if gogetopt.HandleCompletion() {
+//		os.Exit(0)
+//	}
+func (p *Parser) HandleCompletion() bool {
+	if len(os.Args) < 2 || os.Args[1] != COMPLETE_ARG {
+		return false
+	}
+
+	for _, candidate := range p.Complete(os.Args[2:]) {
+		fmt.Println(candidate)
+	}
+	return true
+}
+
+// Set what completion offers for an option's value on the default parser.  See Parser.SetCompletion().
+func SetCompletion(key string, kind CompletionKind) error {
+	return defaultParser.SetCompletion(key, kind)
+}
+
+// Get a completion script for the default parser.  See Parser.GetCompletionScript().
+func GetCompletionScript(shell string) (string, error) {
+	return defaultParser.GetCompletionScript(shell)
+}
+
+// Set an option's completion function on the default parser.  See Parser.SetCompletionFunc().
+func SetCompletionFunc(key string, fn CompletionFunc) error {
+	return defaultParser.SetCompletionFunc(key, fn)
+}
+
+// Set the args completion function on the default parser.  See Parser.SetArgsCompletionFunc().
+func SetArgsCompletionFunc(fn CompletionFunc) {
+	defaultParser.SetArgsCompletionFunc(fn)
+}
+
+// Get the completions for a command line with the default parser.  See Parser.Complete().
+func Complete(args []string) []string {
+	return defaultParser.Complete(args)
+}
+
+// Answer a completion script with the default parser.  See Parser.HandleCompletion().
+func HandleCompletion() bool {
+	return defaultParser.HandleCompletion()
+}
+
+//
+// Helpers
+//
+
+// Work out what sort of word the one being completed is.  The parse loop calls this when it gets to
+// the word, instead of parsing it.
+func (p *Parser) completeWord(arg string) {
+	c := p.completing
+	c.found = true
+	c.parser = p
+
+	eq := strings.Index(arg, "=")
+	if multiDash.MatchString(arg) && eq > 2 {
+		// --foo=val, completing the value.  It's split at the first = since the value can have one
+		// too, and there may be nothing after the = yet.
+		o, err := p.lookupLong(arg[2:eq])
+		if err == nil && o != nil && !o.isBool {
+			c.slot = slotValue
+			c.opt = o
+			c.prefix = arg[:eq+1]
+			c.partial = arg[eq+1:]
+		}
+
+	} else if strings.HasPrefix(arg, "-") {
+		c.slot = slotOptName
+
+		// A group of short options with a value at the end, like -xfVAL or -xf=VAL
+		if singleDash.MatchString(arg) && !multiDash.MatchString(arg) {
+			clustered, val, hasVal, err := p.splitShortCluster(arg)
+			if err == nil && hasVal {
+				c.slot = slotValue
+				c.opt = clustered[len(clustered)-1]
+				c.prefix = arg[:len(arg)-len(val)]
+				c.partial = val
+
+			} else if eq > 1 {
+				// Or with nothing after the = yet, like -xf=
+				clustered, _, hasVal, err = p.splitShortCluster(arg[:eq])
+				if err == nil && !hasVal && !clustered[len(clustered)-1].isBool {
+					c.slot = slotValue
+					c.opt = clustered[len(clustered)-1]
+					c.prefix = arg[:eq+1]
+					c.partial = arg[eq+1:]
+				}
+			}
+		}
+
+	} else {
+		c.slot = slotArg
+	}
+}
+
+// Check if the word being completed is the value of the option at args[i].  If it is, it's recorded
+// and the parse loop should stop.
+func (p *Parser) completeVal(o *opt, i int) bool {
+	c := p.completing
+	if c == nil || c.at != i+1 {
+		return false
+	}
+
+	c.found = true
+	c.parser = p
+	c.slot = slotValue
+	c.opt = o
+	return true
+}
+
+// The parse loop has stopped looking at options at args[i], so if the word being completed comes after
+// that, it's a non-option argument
+func (p *Parser) completeRest(i int) {
+	c := p.completing
+	if c == nil || c.at <= i {
+		return
+	}
+
+	c.found = true
+	c.parser = p
+	c.slot = slotArg
+}
+
+// A parser in the command tree, with what completion needs to know about it
+type completionNode struct {
+
+	// The command path, "" for the top of the tree
+	path string
+
+	// Names of the options which take the next argument as their value, with what to offer for it
+	valueOpts  []string
+	valueKinds []CompletionKind
+
+	// Option names to offer, including --no-<long> forms, and command names to offer
+	optNames []string
+	cmdNames []string
+	cmdUsage []string
+
+	// Short keys of the switches, which can come before a value-taking short option in a group
+	switches []string
+
+	// For fish, which lists each option once rather than each name
+	opts []*opt
+
+	// Whether non-option args are completed by the program
+	dynamicArgs bool
+}
+
+// Collect every parser in the tree under this one, depth first
+func (p *Parser) completionNodes() []*completionNode {
+	node := new(completionNode)
+	node.path = p.GetCommandPath()
+
+	own, inherited := p.shownOpts()
+	node.opts = append(own, inherited...)
+
+	all := append(append(make([]*opt, 0), p.order...), p.inheritedOpts()...)
+	for _, o := range all {
+		if !o.isBool && !o.isOptional {
+			for _, name := range optNames(o) {
+				node.valueOpts = append(node.valueOpts, name)
+				node.valueKinds = append(node.valueKinds, o.completion)
+			}
+		}
+
+		if o.isBool && len(o.short) == 1 {
+			node.switches = append(node.switches, o.short)
+		}
+	}
+
+	for _, o := range node.opts {
+		node.optNames = append(node.optNames, optNames(o)...)
+		if o.negation != nil {
+			node.optNames = append(node.optNames, "--"+o.negation.long)
+		}
+	}
+
+	for _, cmd := range p.commandOrder {
+		node.cmdNames = append(node.cmdNames, cmd.name)
+		node.cmdUsage = append(node.cmdUsage, cmd.cmdUsage)
+	}
+	node.dynamicArgs = len(p.commandOrder) == 0 && p.argsCompleteFunc != nil
+
+	nodes := []*completionNode{node}
+	for _, cmd := range p.commandOrder {
+		nodes = append(nodes, cmd.completionNodes()...)
+	}
+	return nodes
+}
+
+// Check if anything in the tree is completed by the program at completion time
+func hasDynamic(nodes []*completionNode) bool {
+	for _, node := range nodes {
+		if node.dynamicArgs {
+			return true
+		}
+
+		for _, kind := range node.valueKinds {
+			if kind == completeDynamic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get the names an option can be given by on the command line, short first
+func optNames(o *opt) []string {
+	names := make([]string, 0)
+	if o.short != "" {
+		names = append(names, "-"+o.short)
+	}
+
+	if o.long != "" {
+		names = append(names, "--"+o.long)
+	}
+	return names
+}
+
+// Get the name of the program for the script's function names, with anything which can't go in one
+// swapped for an underscore
+func completionFuncName(prog string) string {
+	return "_" + nonFuncChars.ReplaceAllString(prog, "_")
+}
+
+// Get the part of the bash and zsh scripts which walks the words before the one being completed,
+// following commands down the tree and skipping over option values.  It leaves the command path in
+// cmdpath, and if the word being completed is an option's value, sets skip and leaves the option in
+// opt as "<cmdpath>:<name>".  A group of short options like -vo counts as its last one, the way
+// splitShortCluster() sees it, when everything before that is a switch.
+func shellWalk(nodes []*completionNode) string {
+	walk := "        if [[ \"$word\" == -[!-]?* ]]; then\n"
+	walk += "            case \"$cmdpath\" in\n"
+	for _, node := range nodes {
+		walk += "                " + shellQuote(node.path) + ")\n"
+		walk += "                    flags=" + shellQuote(strings.Join(node.switches, "")) + "\n"
+		walk += "                    ;;\n"
+	}
+	walk += "            esac\n"
+	walk += "            while [[ ${#word} -gt 2 && \"$flags\" == *\"${word:1:1}\"* ]]; do\n"
+	walk += "                word=\"-${word:2}\"\n"
+	walk += "            done\n"
+	walk += "        fi\n"
+	walk += "        case \"$cmdpath:$word\" in\n"
+	for _, node := range nodes {
+		if len(node.valueOpts) > 0 {
+			patterns := make([]string, 0)
+			for _, name := range node.valueOpts {
+				patterns = append(patterns, shellQuote(node.path+":"+name))
+			}
+			walk += "            " + strings.Join(patterns, "|") + ")\n"
+			walk += "                opt=\"$cmdpath:$word\"\n"
+			walk += "                skip=1\n"
+			walk += "                ;;\n"
+		}
+
+		for _, name := range node.cmdNames {
+			path := strings.TrimSpace(node.path + " " + name)
+			walk += "            " + shellQuote(node.path+":"+name) + ")\n"
+			walk += "                cmdpath=" + shellQuote(path) + "\n"
+			walk += "                ;;\n"
+		}
+	}
+	walk += "        esac\n"
+	return walk
+}
+
+// Get the patterns for the options whose values complete as the given kind, for a case statement in
+// the bash and zsh scripts.  Returns "" if there aren't any.
+func shellKindPatterns(nodes []*completionNode, kind CompletionKind) string {
+	patterns := make([]string, 0)
+	for _, node := range nodes {
+		for i, name := range node.valueOpts {
+			if node.valueKinds[i] == kind {
+				patterns = append(patterns, shellQuote(node.path+":"+name))
+			}
+		}
+	}
+	return strings.Join(patterns, "|")
+}
+
+// Build the bash completion script
+func (p *Parser) bashCompletion() string {
+	prog := p.getProgName()
+	fn := completionFuncName(prog)
+	nodes := p.completionNodes()
+
+	script := "# bash completion for " + prog + ", generated by gogetopt\n"
+	if hasDynamic(nodes) {
+		script += "\n# Ask the program for completions only it knows\n"
+		script += fn + "_dynamic() {\n"
+		script += "    local IFS=$'\\n'\n"
+		script += "    COMPREPLY=($(\"${COMP_WORDS[0]}\" " + COMPLETE_ARG + " \"$@\" 2>/dev/null))\n"
+		script += "}\n\n"
+	}
+
+	script += fn + "() {\n"
+	script += "    # bash splits --opt=val into three words at the =, so drop the = to leave --opt val\n"
+	script += "    local -a words=()\n"
+	script += "    local i\n"
+	script += "    for ((i = 1; i <= COMP_CWORD; i++)); do\n"
+	script += "        if [[ \"${COMP_WORDS[i]}\" == \"=\" && \"${COMP_WORDS[i-1]}\" == -* ]]; then\n"
+	script += "            if ((i == COMP_CWORD)); then\n"
+	script += "                words+=(\"\")\n"
+	script += "            fi\n"
+	script += "            continue\n"
+	script += "        fi\n"
+	script += "        words+=(\"${COMP_WORDS[i]}\")\n"
+	script += "    done\n\n"
+
+	script += "    local cur=\"${words[${#words[@]}-1]}\"\n"
+	script += "    local cmdpath=\"\" opt=\"\" skip=0 flags=\"\" word\n"
+	script += "    for word in \"${words[@]:0:${#words[@]}-1}\"; do\n"
+	script += "        if ((skip)); then\n"
+	script += "            skip=0\n"
+	script += "            continue\n"
+	script += "        fi\n"
+	script += shellWalk(nodes)
+	script += "    done\n\n"
+
+	script += "    if ((skip)); then\n"
+	script += "        case \"$opt\" in\n"
+	files := shellKindPatterns(nodes, COMPLETE_FILE)
+	if files != "" {
+		script += "            " + files + ")\n"
+		script += "                COMPREPLY=($(compgen -f -- \"$cur\"))\n"
+		script += "                ;;\n"
+	}
+	dirs := shellKindPatterns(nodes, COMPLETE_DIR)
+	if dirs != "" {
+		script += "            " + dirs + ")\n"
+		script += "                COMPREPLY=($(compgen -d -- \"$cur\"))\n"
+		script += "                ;;\n"
+	}
+	dynamic := shellKindPatterns(nodes, completeDynamic)
+	if dynamic != "" {
+		script += "            " + dynamic + ")\n"
+		script += "                " + fn + "_dynamic \"${words[@]}\"\n"
+		script += "                ;;\n"
+	}
+	script += "            *)\n"
+	script += "                COMPREPLY=()\n"
+	script += "                ;;\n"
+	script += "        esac\n"
+	script += "        return\n"
+	script += "    fi\n\n"
+
+	if hasDynamic(nodes) {
+		script += "    local opts=\"\" cmds=\"\" dyn=0\n"
+	} else {
+		script += "    local opts=\"\" cmds=\"\"\n"
+	}
+	script += "    case \"$cmdpath\" in\n"
+	for _, node := range nodes {
+		script += "        " + shellQuote(node.path) + ")\n"
+		script += "            opts=" + shellQuote(strings.Join(node.optNames, " ")) + "\n"
+		script += "            cmds=" + shellQuote(strings.Join(node.cmdNames, " ")) + "\n"
+		if node.dynamicArgs {
+			script += "            dyn=1\n"
+		}
+		script += "            ;;\n"
+	}
+	script += "    esac\n\n"
+
+	script += "    if [[ \"$cur\" == -* ]]; then\n"
+	script += "        COMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))\n"
+	script += "    elif [[ -n \"$cmds\" ]]; then\n"
+	script += "        COMPREPLY=($(compgen -W \"$cmds\" -- \"$cur\"))\n"
+	if hasDynamic(nodes) {
+		script += "    elif ((dyn)); then\n"
+		script += "        " + fn + "_dynamic \"${words[@]}\"\n"
+	}
+	script += "    else\n"
+	script += "        COMPREPLY=($(compgen -f -- \"$cur\"))\n"
+	script += "    fi\n"
+	script += "}\n"
+	script += "complete -o filenames -F " + fn + " " + prog + "\n"
+	return script
+}
+
+// Build the zsh completion script.  It works both from $fpath, where zsh runs the file as the
+// completion function, and sourced, where it registers the function with compdef.
+func (p *Parser) zshCompletion() string {
+	prog := p.getProgName()
+	fn := completionFuncName(prog)
+	nodes := p.completionNodes()
+
+	script := "#compdef " + prog + "\n"
+	script += "# zsh completion for " + prog + ", generated by gogetopt\n"
+	if hasDynamic(nodes) {
+		script += "\n# Ask the program for completions only it knows\n"
+		script += fn + "_dynamic() {\n"
+		script += "    local -a cands\n"
+		script += "    cands=(${(f)\"$(\"${words[1]}\" " + COMPLETE_ARG + " \"$@\" 2>/dev/null)\"})\n"
+		script += "    compadd -- \"${cands[@]}\"\n"
+		script += "}\n\n"
+	}
+
+	script += fn + "() {\n"
+	script += "    local cur=\"${words[CURRENT]}\"\n"
+	script += "    local cmdpath=\"\" opt=\"\" skip=0 flags=\"\" word i\n"
+	script += "    for ((i = 2; i < CURRENT; i++)); do\n"
+	script += "        word=\"${words[i]}\"\n"
+	script += "        if ((skip)); then\n"
+	script += "            skip=0\n"
+	script += "            continue\n"
+	script += "        fi\n"
+	script += shellWalk(nodes)
+	script += "    done\n\n"
+
+	script += "    # zsh keeps --opt=val as one word, so complete what's after the = as the option's value\n"
+	script += "    local -a args\n"
+	script += "    args=(\"${(@)words[2,CURRENT-1]}\")\n"
+	script += "    if ((!skip)) && [[ \"$cur\" == -*=* ]]; then\n"
+	script += "        word=\"${cur%%=*}\"\n"
+	script += shellWalk(nodes)
+	script += "        if ((skip)); then\n"
+	script += "            args+=(\"${cur%%=*}\")\n"
+	script += "            compset -P 1 '*='\n"
+	script += "            cur=\"${cur#*=}\"\n"
+	script += "        fi\n"
+	script += "    fi\n\n"
+
+	script += "    if ((skip)); then\n"
+	script += "        case \"$opt\" in\n"
+	files := shellKindPatterns(nodes, COMPLETE_FILE)
+	if files != "" {
+		script += "            " + files + ")\n"
+		script += "                _files\n"
+		script += "                ;;\n"
+	}
+	dirs := shellKindPatterns(nodes, COMPLETE_DIR)
+	if dirs != "" {
+		script += "            " + dirs + ")\n"
+		script += "                _files -/\n"
+		script += "                ;;\n"
+	}
+	dynamic := shellKindPatterns(nodes, completeDynamic)
+	if dynamic != "" {
+		script += "            " + dynamic + ")\n"
+		script += "                " + fn + "_dynamic \"${args[@]}\" \"$cur\"\n"
+		script += "                ;;\n"
+	}
+	script += "        esac\n"
+	script += "        return\n"
+	script += "    fi\n\n"
+
+	script += "    local -a opts cmds\n"
+	if hasDynamic(nodes) {
+		script += "    local dyn=0\n"
+	}
+	script += "    case \"$cmdpath\" in\n"
+	for _, node := range nodes {
+		script += "        " + shellQuote(node.path) + ")\n"
+		script += "            opts=(" + shellQuoteAll(node.optNames) + ")\n"
+		script += "            cmds=(" + shellQuoteAll(node.cmdNames) + ")\n"
+		if node.dynamicArgs {
+			script += "            dyn=1\n"
+		}
+		script += "            ;;\n"
+	}
+	script += "    esac\n\n"
+
+	script += "    if [[ \"$cur\" == -* ]]; then\n"
+	script += "        compadd -- \"${opts[@]}\"\n"
+	script += "    elif ((${#cmds})); then\n"
+	script += "        compadd -- \"${cmds[@]}\"\n"
+	if hasDynamic(nodes) {
+		script += "    elif ((dyn)); then\n"
+		script += "        " + fn + "_dynamic \"${args[@]}\" \"$cur\"\n"
+	}
+	script += "    else\n"
+	script += "        _files\n"
+	script += "    fi\n"
+	script += "}\n\n"
+
+	script += "if [[ \"${funcstack[1]}\" == \"" + fn + "\" ]]; then\n"
+	script += "    " + fn + " \"$@\"\n"
+	script += "else\n"
+	script += "    compdef " + fn + " " + prog + "\n"
+	script += "fi\n"
+	return script
+}
+
+// Build the fish completion script.  fish does the work of telling option values from option names
+// itself, so the script only has to say which options take values and where in the tree each option
+// and command belongs.
+func (p *Parser) fishCompletion() string {
+	prog := p.getProgName()
+	fn := completionFuncName(prog)
+	nodes := p.completionNodes()
+
+	script := "# fish completion for " + prog + ", generated by gogetopt\n"
+	script += "function " + fn + "_cmdpath\n"
+	script += "    set -l cmdpath \"\"\n"
+	script += "    set -l skip 0\n"
+	script += "    for word in (commandline -opc)[2..-1]\n"
+	script += "        if test $skip = 1\n"
+	script += "            set skip 0\n"
+	script += "            continue\n"
+	script += "        end\n"
+	script += "        if string match -qr -- '^-[^-].' $word\n"
+	script += "            set -l flags\n"
+	script += "            switch $cmdpath\n"
+	for _, node := range nodes {
+		script += "                case " + fishQuote(node.path) + "\n"
+		flags := make([]string, 0)
+		for _, short := range node.switches {
+			flags = append(flags, fishQuote(short))
+		}
+		script += "                    set flags " + strings.Join(flags, " ") + "\n"
+	}
+	script += "            end\n"
+	script += "            while test (string length -- $word) -gt 2; and contains -- (string sub -s 2 -l 1 -- $word) $flags\n"
+	script += "                set word -(string sub -s 3 -- $word)\n"
+	script += "            end\n"
+	script += "        end\n"
+	script += "        switch \"$cmdpath:$word\"\n"
+	for _, node := range nodes {
+		if len(node.valueOpts) > 0 {
+			patterns := make([]string, 0)
+			for _, name := range node.valueOpts {
+				patterns = append(patterns, fishQuote(node.path+":"+name))
+			}
+			script += "            case " + strings.Join(patterns, " ") + "\n"
+			script += "                set skip 1\n"
+		}
+
+		for _, name := range node.cmdNames {
+			script += "            case " + fishQuote(node.path+":"+name) + "\n"
+			script += "                set cmdpath " + fishQuote(strings.TrimSpace(node.path+" "+name)) + "\n"
+		}
+	}
+	script += "        end\n"
+	script += "    end\n"
+	script += "    echo $cmdpath\n"
+	script += "end\n\n"
+
+	if hasDynamic(nodes) {
+		script += "# Ask the program for completions only it knows\n"
+		script += "function " + fn + "_dynamic\n"
+		script += "    set -l tokens (commandline -opc) (commandline -ct)\n\n"
+		script += "    # fish completes the value after --opt= itself and puts the --opt= back on, so ask for\n"
+		script += "    # just the value\n"
+		script += "    if string match -qr -- '^-[^=]+=' $tokens[-1]\n"
+		script += "        set tokens $tokens[1..-2] (string split -m 1 = -- $tokens[-1])\n"
+		script += "    end\n"
+		script += "    $tokens[1] " + COMPLETE_ARG + " $tokens[2..-1] 2>/dev/null\n"
+		script += "end\n\n"
+	}
+
+	script += "function " + fn + "_using\n"
+	script += "    set -l cmdpath (" + fn + "_cmdpath)\n"
+	script += "    test \"$cmdpath\" = \"$argv[1]\"\n"
+	script += "end\n\n"
+
+	for _, node := range nodes {
+		cond := " -n " + fishQuote(fn+"_using \""+node.path+"\"")
+
+		// Levels with commands take a command, not a file, and the program can say what else to take
+		if len(node.cmdNames) > 0 {
+			script += "complete -c " + prog + cond + " -f\n"
+		} else if node.dynamicArgs {
+			script += "complete -c " + prog + cond + " -f -a '(" + fn + "_dynamic)'\n"
+		}
+
+		for _, o := range node.opts {
+			line := "complete -c " + prog + cond
+			if o.short != "" {
+				line += " -s " + fishQuote(o.short)
+			}
+
+			if o.long != "" {
+				line += " -l " + fishQuote(o.long)
+			}
+
+			if !o.isBool && !o.isOptional {
+				switch o.completion {
+				case completeDynamic:
+					line += " -x -a '(" + fn + "_dynamic)'"
+				case COMPLETE_FILE:
+					line += " -r -F"
+				case COMPLETE_DIR:
+					line += " -x -a '(__fish_complete_directories)'"
+				default:
+					line += " -x"
+				}
+			}
+
+			_, usage := unquoteUsage(o.usage)
+			if usage != "" {
+				line += " -d " + fishQuote(usage)
+			}
+			script += line + "\n"
+
+			if o.negation != nil {
+				script += "complete -c " + prog + cond + " -l " + fishQuote(o.negation.long) + "\n"
+			}
+		}
+
+		for i, name := range node.cmdNames {
+			line := "complete -c " + prog + cond + " -a " + fishQuote(name)
+			if node.cmdUsage[i] != "" {
+				line += " -d " + fishQuote(node.cmdUsage[i])
+			}
+			script += line + "\n"
+		}
+	}
+	return script
+}
+
+// Quote a string for bash, zsh or fish.  Single quotes keep everything as it is, and a single quote
+// inside is closed, escaped and reopened, which all three understand.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
+
+// Quote a string for fish, which unlike the others treats backslashes in single quotes as escapes
+func fishQuote(s string) string {
+	return shellQuote(strings.Replace(s, "\\", "\\\\", -1))
+}
+
+// Quote a list of strings for a shell array
+func shellQuoteAll(list []string) string {
+	quoted := make([]string, 0)
+	for _, s := range list {
+		quoted = append(quoted, shellQuote(s))
+	}
+	return strings.Join(quoted, " ")
+}
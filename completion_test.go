@@ -0,0 +1,320 @@
+package gogetopt
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Build a parser to generate completion scripts for
+func buildCompletionParser(t *testing.T) *Parser {
+	p := NewParser()
+	p.SetProgName("prog")
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "Say more, it's handy")
+	regErr = p.RegisterOpt("output", "output", "o", false, false, "Write to `FILE`")
+	regErr = p.RegisterOpt("dir", "dir", "C", false, false, "Run in a directory")
+	regErr = p.RegisterOpt("name", "name", "", false, false, "A name")
+	regErr = p.RegisterOpt("secret", "secret", "", true, false, "Not shown")
+
+	if regErr != nil {
+		t.Fatal("GetCompletionScript() test: Got reg error: " + regErr.Error())
+	}
+
+	p.SetNegatable("verbose")
+	p.SetPersistent("verbose")
+	p.SetHidden("secret")
+
+	if p.SetCompletion("output", COMPLETE_FILE) != nil || p.SetCompletion("dir", COMPLETE_DIR) != nil {
+		t.Error("SetCompletion() failed for a registered key")
+	}
+
+	if p.SetCompletion("nope", COMPLETE_FILE) == nil {
+		t.Error("SetCompletion() didn't fail for an unregistered key")
+	}
+
+	deploy, _ := p.AddCommand("deploy", "Deploy the app", nil)
+	deploy.RegisterOpt("env", "env", "e", false, false, "Where to")
+	remote, _ := p.AddCommand("remote", "Manage remotes", nil)
+	remote.AddCommand("add", "Add a remote", nil)
+	return p
+}
+
+// Each script knows the options, which of them take values, and the commands
+func TestCompletionScripts(t *testing.T) {
+	p := buildCompletionParser(t)
+
+	_, err := p.GetCompletionScript("powershell")
+	if err == nil || err.Error() != ERR_UNKNOWN_SHELL+"powershell" {
+		t.Errorf("GetCompletionScript() test: Didn't get the right error for an unknown shell, got: %v", err)
+	}
+
+	expected := map[string][]string{
+		"bash": {
+			"complete -o filenames -F _prog prog\n",
+			"':-o'|':--output'|':-C'|':--dir'|':--name')",
+			"'deploy:-e'|'deploy:--env')",
+			"opts='-v --verbose --no-verbose -o --output -C --dir --name'",
+			"cmds='deploy remote'",
+			"'remote:add')\n                cmdpath='remote add'",
+		},
+		"zsh": {
+			"#compdef prog\n",
+			"compdef _prog prog\n",
+			"':-C'|':--dir')\n                _files -/\n",
+			"compset -P 1 '*='\n",
+			"'')\n                    flags='v'\n",
+			"opts=('-e' '--env' '-v' '--verbose' '--no-verbose')",
+		},
+		"fish": {
+			"complete -c prog -n '_prog_using \"\"' -s 'v' -l 'verbose' -d 'Say more, it'\\''s handy'\n",
+			"complete -c prog -n '_prog_using \"\"' -s 'o' -l 'output' -r -F -d 'Write to FILE'\n",
+			"complete -c prog -n '_prog_using \"\"' -s 'C' -l 'dir' -x -a '(__fish_complete_directories)'",
+			"complete -c prog -n '_prog_using \"deploy\"' -s 'e' -l 'env' -x -d 'Where to'\n",
+			"complete -c prog -n '_prog_using \"remote\"' -a 'add' -d 'Add a remote'\n",
+			"                case ''\n                    set flags 'v'\n",
+		},
+	}
+
+	for shell, parts := range expected {
+		script, err := p.GetCompletionScript(shell)
+		if err != nil {
+			t.Error("GetCompletionScript() failed for " + shell + ": " + err.Error())
+			continue
+		}
+
+		for _, part := range parts {
+			if !strings.Contains(script, part) {
+				t.Error("GetCompletionScript() test: " + shell + " script is missing: " + part + "\nGot:\n" + script)
+			}
+		}
+
+		if strings.Contains(script, "secret") {
+			t.Error("GetCompletionScript() test: " + shell + " script offers a hidden option")
+		}
+	}
+
+	// Commands get the script for the whole program
+	deploy := p.commands["deploy"]
+	fromRoot, _ := p.GetCompletionScript("bash")
+	fromCmd, _ := deploy.GetCompletionScript("bash")
+	if fromRoot != fromCmd {
+		t.Error("GetCompletionScript() test: A command didn't get the whole program's script")
+	}
+}
+
+// Run the bash script against some command lines, when bash is around to do it.  Completions are
+// sorted so the file names come out the same everywhere.
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash isn't installed")
+	}
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "subdir"), 0755)
+	os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0644)
+
+	script, _ := buildCompletionParser(t).GetCompletionScript("bash")
+	os.WriteFile(filepath.Join(dir, "prog.bash"), []byte(script), 0644)
+
+	tests := map[string]string{
+		"prog --":              "--dir --name --no-verbose --output --verbose",
+		"prog ''":              "deploy remote",
+		"prog -o ''":           "file.txt prog.bash subdir",
+		"prog -C ''":           "subdir",
+		"prog --name ''":       "",
+		"prog deploy -":        "--env --no-verbose --verbose -e -v",
+		"prog -v remote ''":    "add",
+		"prog remote add --no": "--no-verbose",
+		"prog deploy -e x ''":  "file.txt prog.bash subdir",
+
+		// bash splits --output=fi into three words at the =
+		"prog --output = fi": "file.txt",
+		"prog --output =":    "file.txt prog.bash subdir",
+		"prog -C = ''":       "subdir",
+
+		// The last of a group of short options takes the next word, so it's never a command
+		"prog -vo ''":        "file.txt prog.bash subdir",
+		"prog -vC ''":        "subdir",
+		"prog -vo deploy -":  "--dir --name --no-verbose --output --verbose -C -o -v",
+		"prog -vo deploy ''": "deploy remote",
+		"prog -ov deploy -":  "--env --no-verbose --verbose -e -v",
+	}
+
+	for line, expected := range tests {
+		sim := "source prog.bash\n"
+		sim += "COMP_WORDS=(" + line + ")\n"
+		sim += "COMP_CWORD=$((${#COMP_WORDS[@]} - 1))\n"
+		sim += "_prog\n"
+		sim += "printf '%s\\n' \"${COMPREPLY[@]}\" | LC_ALL=C sort | paste -sd ' '\n"
+
+		cmd := exec.Command(bash, "-c", sim)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error("Bash completion test: Running the script failed for " + line + ": " + err.Error())
+			continue
+		}
+
+		got := strings.TrimSpace(string(out))
+		if got != expected {
+			t.Error("Bash completion test: Wrong completions for " + line + ".  Expected: " + expected + " Got: " + got)
+		}
+	}
+}
+
+// Build a parser with completion functions, which report the options parsed before the word
+func buildDynamicParser(t *testing.T) *Parser {
+	p := NewParser()
+	p.SetProgName("prog")
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "test usage")
+	regErr = p.RegisterOpt("cluster", "cluster", "c", false, false, "test usage")
+	regErr = p.RegisterOpt("region", "region", "r", false, false, "test usage")
+
+	if regErr != nil {
+		t.Fatal("Complete() test: Got reg error: " + regErr.Error())
+	}
+
+	p.SetPersistent("cluster")
+	p.SetCompletionFunc("cluster", func(cmd *Parser, partial string) []string {
+		if cmd.GetString("region") == "eu" {
+			return []string{"paris", "berlin"}
+		}
+		return []string{"prod", "prod-backup", "staging"}
+	})
+
+	if p.SetCompletionFunc("nope", nil) == nil {
+		t.Error("SetCompletionFunc() didn't fail for an unregistered key")
+	}
+
+	logs, _ := p.AddCommand("logs", "Show logs", nil)
+	logs.RegisterOpt("follow", "follow", "f", true, false, "test usage")
+	logs.SetArgsCompletionFunc(func(cmd *Parser, partial string) []string {
+		if cmd.GetBool("follow") {
+			return []string{"web-live"}
+		}
+		return []string{"web", "worker"}
+	})
+
+	p.AddCommand("deploy", "Deploy", nil)
+	return p
+}
+
+// The word being completed is worked out with the same parsing as ParseArgs()
+func TestComplete(t *testing.T) {
+	p := buildDynamicParser(t)
+
+	tests := map[string]string{
+		"":                             "logs deploy",
+		"d":                            "deploy",
+		"--c":                          "--cluster",
+		"-":                            "-v --verbose -c --cluster -r --region",
+		"-c|":                          "prod prod-backup staging",
+		"--cluster|pro":                "prod prod-backup",
+		"--cluster=pro":                "--cluster=prod --cluster=prod-backup",
+		"--cluster=":                   "--cluster=prod --cluster=prod-backup --cluster=staging",
+		"-c=":                          "-c=prod -c=prod-backup -c=staging",
+		"-vc=st":                       "-vc=staging",
+		"--region=":                    "",
+		"-cpro":                        "-cprod -cprod-backup",
+		"-vcst":                        "-vcstaging",
+		"-r|eu|-c|":                    "paris berlin",
+		"logs|-c|":                     "prod prod-backup staging",
+		"logs|":                        "web worker",
+		"logs|-f|w":                    "web-live",
+		"logs|--|-":                    "",
+		"logs|--":                      "--follow --cluster",
+		"--verbose=":                   "",
+		"--nope|":                      "",
+		"-r|":                          "",
+		"logs|-f|--cluster|prod|-c|st": "staging",
+	}
+
+	for line, expected := range tests {
+		args := strings.Split(line, "|")
+		got := strings.Join(p.Complete(args), " ")
+		if got != expected {
+			t.Error("Complete() test: Wrong completions for " + strings.Join(args, " ") + ".  Expected: " + expected + " Got: " + got)
+		}
+	}
+
+	// Completing leaves the parser ready for a normal parse
+	p.ParseArgs([]string{"logs", "-f"})
+	if p.HasError() || !p.GetCommand().GetBool("follow") {
+		t.Error("Complete() test: Parser didn't parse normally after completing")
+	}
+}
+
+// The scripts ask the program for values and args with completion functions
+func TestDynamicCompletionScripts(t *testing.T) {
+	p := buildDynamicParser(t)
+
+	expected := map[string][]string{
+		"bash": {
+			"COMPREPLY=($(\"${COMP_WORDS[0]}\" __complete \"$@\" 2>/dev/null))",
+			"':-c'|':--cluster'|'logs:-c'|'logs:--cluster'|'deploy:-c'|'deploy:--cluster')\n                _prog_dynamic \"${words[@]}\"\n",
+		},
+		"zsh": {
+			"\"$(\"${words[1]}\" __complete \"$@\" 2>/dev/null)\"",
+			"_prog_dynamic \"${args[@]}\" \"$cur\"\n",
+			"'logs')\n            opts=('-f' '--follow' '-c' '--cluster')\n            cmds=()\n            dyn=1\n",
+		},
+		"fish": {
+			"$tokens[1] __complete $tokens[2..-1] 2>/dev/null\n",
+			"set tokens $tokens[1..-2] (string split -m 1 = -- $tokens[-1])\n",
+			"complete -c prog -n '_prog_using \"\"' -s 'c' -l 'cluster' -x -a '(_prog_dynamic)' -d 'test usage'\n",
+			"complete -c prog -n '_prog_using \"logs\"' -f -a '(_prog_dynamic)'\n",
+		},
+	}
+
+	for shell, parts := range expected {
+		script, _ := p.GetCompletionScript(shell)
+		for _, part := range parts {
+			if !strings.Contains(script, part) {
+				t.Error("GetCompletionScript() test: " + shell + " script is missing: " + part + "\nGot:\n" + script)
+			}
+		}
+	}
+
+	// Scripts without completion functions don't call the program
+	script, _ := buildCompletionParser(t).GetCompletionScript("bash")
+	if strings.Contains(script, "__complete") {
+		t.Error("GetCompletionScript() test: Script calls the program without any completion functions")
+	}
+
+	// Check the bash script passes the right words, with a function standing in for the program
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return
+	}
+
+	// bash splits --cluster=pr at the =, and the program should see it as --cluster pr
+	runs := map[string]string{
+		"prog logs -c ''":          "arg:__complete\narg:logs\narg:-c\narg:\n",
+		"prog logs --cluster = pr": "arg:__complete\narg:logs\narg:--cluster\narg:pr\n",
+		"prog -vc ''":              "arg:__complete\narg:-vc\narg:\n",
+	}
+
+	script, _ = p.GetCompletionScript("bash")
+	for line, expected := range runs {
+		sim := script
+		sim += "prog() { printf 'arg:%s\\n' \"$@\"; }\n"
+		sim += "COMP_WORDS=(" + line + ")\n"
+		sim += "COMP_CWORD=$((${#COMP_WORDS[@]} - 1))\n"
+		sim += "_prog\n"
+		sim += "printf '%s\\n' \"${COMPREPLY[@]}\"\n"
+
+		out, err := exec.Command(bash, "-c", sim).Output()
+		if err != nil {
+			t.Error("Bash completion test: Running the script failed for " + line + ": " + err.Error())
+		} else if string(out) != expected {
+			t.Error("Bash completion test: The program wasn't run with the right args for " + line + ".  Got: " + string(out))
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package gogetopt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A value (or list of values) for one option, read from a config file
+type configVal struct {
+	vals []string
+	file string
+	line int
+}
+
+// Load option values from one or more config files.  Values are looked up by option key or long
+// name, and are used for any option which isn't given on the command line or in the environment -
+// so the order of precedence is command line, environment, config files, then defaults.  When files
+// set the same option, the file loaded last wins.
+//
+// Files ending in .json (or starting with "{") are read as a JSON object of option names to values.
+// Arrays give several values, but only to options which keep them all (DUP_APPEND).  Other files are
+// read INI-style, one "name = value" per line, with # or ; starting a comment.  A switch can be
+// turned on with just its name on a line (a counter counts once), and [section] headers are allowed
+// but don't change how names are looked up.  Counters otherwise take the count itself as their value.
+//
+// Files can be loaded before or after Parse().  Values loaded after are applied right away, and
+// count towards required options the same as ones loaded before.  Errors about values name the file
+// and line the problem was found on, and are the same *ParseErrors Parse() gives either way.
+func (p *Parser) LoadConfigFile(paths ...string) error {
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(bytes.TrimSpace(contents), []byte("{")) {
+			err = p.loadJSONConfig(path, contents)
+		} else {
+			err = p.loadINIConfig(path, contents)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Already parsed, so the new values have to be applied now.  They might take care of options
+	// which were reported missing as well.
+	if p.parsed {
+		errs := p.applyConfig()
+		for _, err := range errs {
+			p.addError(err)
+		}
+
+		if len(errs) > 0 && !p.collecting() {
+			return errs[0]
+		}
+
+		if errors.Is(p.parseError, KIND_REQ) {
+			p.recheckRequired()
+		}
+		return joinErrors(errs)
+	}
+
+	return nil
+}
+
+// Load config files on the default parser.  See Parser.LoadConfigFile().
+func LoadConfigFile(paths ...string) error {
+	return defaultParser.LoadConfigFile(paths...)
+}
+
+//
+// Helpers
+//
+
+// Check the required options again after values have come in late, replacing the missing options
+// error found by Parse() and keeping any others
+func (p *Parser) recheckRequired() {
+	errs := p.parseErrors
+	p.parseErrors = nil
+	p.parseError = nil
+
+	for _, err := range errs {
+		if !errors.Is(err, KIND_REQ) {
+			p.addError(err)
+		}
+	}
+
+	if err := p.getMissingReqOptsError(); err != nil {
+		p.addError(err)
+	}
+}
+
+// Read "name = value" lines from an INI-style file
+func (p *Parser) loadINIConfig(path string, contents []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Blank lines, comments and section headers
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") ||
+			(strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")) {
+			continue
+		}
+
+		name := line
+		val := ""
+		hasVal := false
+
+		eq := strings.Index(line, "=")
+		if eq >= 0 {
+			name = strings.TrimSpace(line[:eq])
+			val = unquote(strings.TrimSpace(line[eq+1:]))
+			hasVal = true
+		}
+
+		err := p.addConfigVal(name, []string{val}, hasVal, path, lineNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Read a JSON object of names to values.  The object is walked a token at a time so each value can
+// be tied back to the line it was on.
+func (p *Parser) loadJSONConfig(path string, contents []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("%s:1: config file isn't a JSON object", path)
+	}
+
+	for dec.More() {
+		lineNum := lineAt(contents, dec.InputOffset())
+
+		tok, err = dec.Token()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+		name := tok.(string)
+
+		var raw interface{}
+		err = dec.Decode(&raw)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+
+		vals := make([]string, 0)
+		switch v := raw.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			for _, item := range v {
+				str, ok := jsonScalar(item)
+				if !ok {
+					return configError(newParseError(KIND_INVALID_VAL, nil, ERR_INVALID_VAL+name), path, lineNum)
+				}
+				vals = append(vals, str)
+			}
+		default:
+			str, ok := jsonScalar(v)
+			if !ok {
+				return configError(newParseError(KIND_INVALID_VAL, nil, ERR_INVALID_VAL+name), path, lineNum)
+			}
+			vals = append(vals, str)
+		}
+
+		err = p.addConfigVal(name, vals, true, path, lineNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check a value from a config file against the option it's for and hold onto it.  Values which
+// can't possibly work are errors now, while the file and line are easy to report.  They're the same
+// ParseErrors Parse() gives for them.
+func (p *Parser) addConfigVal(name string, vals []string, hasVal bool, path string, lineNum int) error {
+	o, ok := p.opts[name]
+	if !ok {
+		o, ok = p.longKeys[name]
+		if !ok || o.negates != nil {
+			return configError(newParseError(KIND_NO_OPT, nil, ERR_NO_OPT+name), path, lineNum)
+		}
+	}
+
+	// Only options which keep every value can be given a list of them
+	if len(vals) > 1 && o.dupPolicy != DUP_APPEND {
+		return configError(newParseError(KIND_INVALID_VAL, o, ERR_INVALID_VAL+optDisplayName(o)+" takes a single value, not a list"), path, lineNum)
+	}
+
+	for i, val := range vals {
+		if o.isCounter {
+
+			// A counter on its own line counts once
+			if !hasVal {
+				vals[i] = "1"
+				continue
+			}
+
+			_, err := parseCount(o, val)
+			if err != nil {
+				return configError(err, path, lineNum)
+			}
+			continue
+		}
+
+		if o.isBool {
+
+			// A switch on its own line just turns it on
+			if !hasVal {
+				vals[i] = "true"
+				continue
+			}
+
+			_, isBoolVal := parseBoolVal(val)
+			if !isBoolVal {
+				return configError(newParseError(KIND_BOOL_WITH_VAL, o, ERR_BOOL_WITH_VAL+name+" = "+val), path, lineNum)
+			}
+			continue
+		}
+
+		if !hasVal || val == "" {
+			return configError(newParseError(KIND_MISSING_VAL, o, ERR_MISSING_VAL+name), path, lineNum)
+		}
+
+		_, err := convertVal(o, val)
+		if err != nil {
+			return configError(err, path, lineNum)
+		}
+	}
+
+	p.configVals[o.key] = &configVal{vals: vals, file: path, line: lineNum}
+	return nil
+}
+
+// Fill in every option which hasn't been given a value yet but has one from a config file.  Returns
+// the first bad value, or every one of them when errors are being collected.
+func (p *Parser) applyConfig() []error {
+	errs := make([]error, 0)
+	for _, o := range p.order {
+		cv, ok := p.configVals[o.key]
+		if !ok || p.isGiven(o) {
+			continue
+		}
+
+		var err error
+		for _, val := range cv.vals {
+			err = p.setFromString(o, val)
+			if err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, configError(err, cv.file, cv.line))
+			if !p.collecting() {
+				return errs
+			}
+			continue
+		}
+
+		p.sources[o.key] = Source{Kind: SOURCE_CONFIG, Name: cv.file, Line: cv.line}
+	}
+
+	return errs
+}
+
+// Put the file and line a config file value came from in front of an error about it
+func configError(err error, path string, lineNum int) error {
+	return withContext(err, fmt.Sprintf("%s:%d: ", path, lineNum), "")
+}
+
+// Turn a single JSON value into the string the option would get on the command line.  Returns false
+// for anything which isn't a string, number or bool.
+func jsonScalar(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	case bool:
+		if s {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+// Get the line number for a byte offset into a file
+func lineAt(contents []byte, offset int64) int {
+	if offset > int64(len(contents)) {
+		offset = int64(len(contents))
+	}
+
+	// The offset is just past the previous token, so step over the separators to the next one
+	for offset < int64(len(contents)) && strings.ContainsRune(" \t\r\n,", rune(contents[offset])) {
+		offset++
+	}
+	return bytes.Count(contents[:offset], []byte("\n")) + 1
+}
+
+// Remove a matching pair of quotes from around a value, if there are any
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
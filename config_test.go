@@ -0,0 +1,186 @@
+package gogetopt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// Write a config file into the test's temp directory and return its path
+func writeTestConfig(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal("Couldn't write test config file: " + err.Error())
+	}
+	return path
+}
+
+// Register the options the config tests share
+func registerConfigTestOpts(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("host", "hostname", "", false, true, "test usage")
+	regErr = RegisterTypedOpt("port", "port", "p", TYPE_INT, false, "test usage")
+	regErr = RegisterOpt("debug", "debug", "d", true, false, "test usage")
+	regErr = RegisterMultiOpt("tag", "tag", "", false, "test usage")
+	regErr = RegisterCounterOpt("verbose", "verbose", "v", "test usage")
+
+	if regErr != nil {
+		t.Error("Config test: Testing config files but got reg error: " + regErr.Error())
+	}
+}
+
+// INI-style files, by key or long name
+func TestINIConfig(t *testing.T) {
+	registerConfigTestOpts(t)
+	path := writeTestConfig(t, "test.conf", `
+# comment
+[server]
+hostname = "example.com"
+port = 8080
+; another comment
+debug
+verbose
+tag = a
+`)
+
+	if err := LoadConfigFile(path); err != nil {
+		t.Error("LoadConfigFile() failed: " + err.Error())
+	}
+
+	ParseArgs([]string{"--port", "9090"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("host") != "example.com" || !GetBool("debug") || GetString("tag") != "a" {
+		t.Errorf("Config test: Didn't get values from the config file.  Got: %s, %v, %s", GetString("host"), GetBool("debug"), GetString("tag"))
+	}
+
+	if GetInt("port") != 9090 {
+		t.Errorf("Config test: Config file won over the command line.  Got: %d", GetInt("port"))
+	}
+
+	if GetCount("verbose") != 1 {
+		t.Errorf("Config test: A counter on its own line didn't count once.  Got: %d", GetCount("verbose"))
+	}
+
+	// The environment wins over config files too
+	SetEnv("host", "TEST_GOGETOPT_HOST")
+	t.Setenv("TEST_GOGETOPT_HOST", "env.example.com")
+
+	ParseArgs([]string{})
+	if GetString("host") != "env.example.com" {
+		t.Error("Config test: Config file won over the environment.  Got: " + GetString("host"))
+	}
+}
+
+// JSON files, including arrays, loaded after parsing
+func TestJSONConfig(t *testing.T) {
+	registerConfigTestOpts(t)
+	path := writeTestConfig(t, "test.json", `{
+	"host": "example.com",
+	"port": 8080,
+	"debug": false,
+	"tag": ["a", "b"]
+}`)
+
+	// Missing the required option until the file is loaded
+	ParseArgs([]string{"--tag", "c"})
+	if !HasError() {
+		t.Error("Parse() test: Didn't get a parse error when missing required options.")
+	}
+
+	if err := LoadConfigFile(path); err != nil {
+		t.Error("LoadConfigFile() failed: " + err.Error())
+	}
+
+	if HasError() {
+		t.Error("Config test: Required option from a config file loaded after parsing didn't count: " + GetError().Error())
+	}
+
+	if GetString("host") != "example.com" || GetInt("port") != 8080 {
+		t.Errorf("Config test: Didn't get values from the config file.  Got: %s, %d", GetString("host"), GetInt("port"))
+	}
+
+	val, given := LookupBool("debug")
+	if val || !given {
+		t.Errorf("Config test: Didn't get an explicit false from the config file.  Got: %v, %v", val, given)
+	}
+
+	// Command line values win, even over arrays
+	tags := GetStrings("tag")
+	if len(tags) != 1 || tags[0] != "c" {
+		t.Errorf("Config test: Config file won over the command line.  Got: %+v", tags)
+	}
+
+	ParseArgs([]string{})
+	tags = GetStrings("tag")
+	if len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("Config test: Didn't get every value from a JSON array.  Got: %+v", tags)
+	}
+}
+
+// Errors carry the file and line
+func TestConfigErrors(t *testing.T) {
+	registerConfigTestOpts(t)
+
+	cases := map[string]string{
+		"bad.conf":      "hostname = x\n\nnope = 1\n",
+		"badbool.conf":  "debug = sometimes\n",
+		"badtype.conf":  "port = eighty\n",
+		"novalue.conf":  "port\n",
+		"badcount.conf": "verbose = yes\n",
+		"bad.json":      "{\n\t\"host\": \"x\",\n\t\"nope\": 1\n}",
+		"badarray.json": "{\n\t\"tag\": [{}]\n}",
+		"badlist.json":  "{\n\t\"port\": [80, 8080]\n}",
+	}
+
+	expected := map[string]string{
+		"bad.conf":      ":3: " + regexp.QuoteMeta(ERR_NO_OPT+"nope"),
+		"badbool.conf":  ":1: " + regexp.QuoteMeta(ERR_BOOL_WITH_VAL+"debug = sometimes"),
+		"badtype.conf":  ":1: " + regexp.QuoteMeta(ERR_INVALID_VAL),
+		"novalue.conf":  ":1: " + regexp.QuoteMeta(ERR_MISSING_VAL+"port"),
+		"badcount.conf": ":1: " + regexp.QuoteMeta(ERR_INVALID_VAL+"-v or --verbose expects a count, got: yes"),
+		"bad.json":      ":3: " + regexp.QuoteMeta(ERR_NO_OPT+"nope"),
+		"badarray.json": ":2: " + regexp.QuoteMeta(ERR_INVALID_VAL+"tag"),
+		"badlist.json":  ":2: " + regexp.QuoteMeta(ERR_INVALID_VAL+"-p or --port takes a single value, not a list"),
+	}
+
+	// The same kinds of ParseError as Parse() gives
+	kinds := map[string]ErrorKind{
+		"bad.conf":      KIND_NO_OPT,
+		"badbool.conf":  KIND_BOOL_WITH_VAL,
+		"badtype.conf":  KIND_INVALID_VAL,
+		"novalue.conf":  KIND_MISSING_VAL,
+		"badcount.conf": KIND_INVALID_VAL,
+		"bad.json":      KIND_NO_OPT,
+		"badarray.json": KIND_INVALID_VAL,
+		"badlist.json":  KIND_INVALID_VAL,
+	}
+
+	for name, contents := range cases {
+		path := writeTestConfig(t, name, contents)
+		expr := regexp.MustCompile("^" + regexp.QuoteMeta(path) + expected[name])
+
+		err := LoadConfigFile(path)
+		if err == nil || !expr.MatchString(err.Error()) {
+			t.Errorf("LoadConfigFile() didn't give the right error for %s, got: %v", name, err)
+		}
+
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != kinds[name] || pe.Index != -1 {
+			t.Errorf("LoadConfigFile() didn't give the right ParseError for %s, got: %v", name, err)
+		}
+	}
+
+	// Loaded after parsing, a bad value is the same kind of error
+	path := writeTestConfig(t, "late.conf", "port = eighty\n")
+	ParseArgs([]string{"--hostname", "x"})
+	if err := LoadConfigFile(path); !errors.Is(err, KIND_INVALID_VAL) {
+		t.Errorf("LoadConfigFile() didn't give a ParseError after parsing, got: %v", err)
+	}
+}
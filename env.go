@@ -0,0 +1,116 @@
+package gogetopt
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// Bind an option to one or more environment variables.  When the option isn't given on the command
+// line, Parse() checks the variables in the order given and uses the first one which is set to a
+// non-empty value.  Switches take true/false, yes/no or 1/0 from the environment, and counters take
+// a number.  Values from the environment satisfy required options the same as command line ones.
+func (p *Parser) SetEnv(key string, names ...string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.envVars = append(o.envVars, names...)
+	return nil
+}
+
+// Bind an option to environment variables on the default parser.  See Parser.SetEnv().
+func SetEnv(key string, names ...string) error {
+	return defaultParser.SetEnv(key, names...)
+}
+
+//
+// Helpers
+//
+
+// Fill in every option which wasn't given on the command line but has a value in one of its
+// environment variables.  Returns the first bad value, or every one of them when errors are being
+// collected.
+func (p *Parser) applyEnv() []error {
+	errs := make([]error, 0)
+	for _, o := range p.order {
+		if len(o.envVars) == 0 || p.isGiven(o) {
+			continue
+		}
+
+		name, val := lookupEnvVars(o.envVars)
+		if name == "" {
+			continue
+		}
+
+		err := p.setFromString(o, val)
+		if err != nil {
+			errs = append(errs, withContext(err, "", " (from environment variable "+name+")"))
+			if !p.collecting() {
+				return errs
+			}
+			continue
+		}
+
+		p.sources[o.key] = Source{Kind: SOURCE_ENV, Name: name}
+	}
+
+	return errs
+}
+
+// Check if an option was given a value by the parse so far
+func (p *Parser) isGiven(o *opt) bool {
+	_, boolGiven := p.boolVals[o.key]
+	_, stringGiven := p.stringVals[o.key]
+	return boolGiven || stringGiven
+}
+
+// Set an option from a string which didn't come from the command line, like an environment variable.
+// Unlike the command line, switches here need a value saying whether they're on or off, and counters
+// need the count itself.
+func (p *Parser) setFromString(o *opt, val string) error {
+	if o.isCounter {
+		count, err := parseCount(o, val)
+		if err != nil {
+			return err
+		}
+
+		p.counts[o.counterKey] += count * o.step
+		p.boolVals[o.key] = count != 0
+		return nil
+	}
+
+	if o.isBool {
+		boolVal, ok := parseBoolVal(val)
+		if !ok {
+			return newParseError(KIND_INVALID_VAL, o, ERR_INVALID_VAL+optDisplayName(o)+" expects bool, got: "+val)
+		}
+		return p.setBoolVal(o, boolVal, true, -1)
+	}
+
+	return p.setString(o, val, -1)
+}
+
+// Read the count for a counter from a string which didn't come from the command line
+func parseCount(o *opt, val string) (int, error) {
+	count, err := strconv.Atoi(val)
+	if err != nil {
+		e := newParseError(KIND_INVALID_VAL, o, ERR_INVALID_VAL+optDisplayName(o)+" expects a count, got: "+val)
+		e.Err = err
+		return 0, e
+	}
+	return count, nil
+}
+
+// Get the name and value of the first environment variable in the list which is set and not empty.
+// The name is "" if none of them are.
+func lookupEnvVars(names []string) (string, string) {
+	for _, name := range names {
+		val := os.Getenv(name)
+		if val != "" {
+			return name, val
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,87 @@
+package gogetopt
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Options not on the command line fall back on their environment variables
+func TestEnvFallback(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("host", "host", "", false, true, "test usage")
+	regErr = RegisterOpt("port", "port", "p", false, false, "test usage")
+	regErr = RegisterOpt("debug", "debug", "d", true, false, "test usage")
+	regErr = RegisterCounterOpt("verbose", "verbose", "v", "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	SetEnv("host", "TEST_GOGETOPT_HOST", "TEST_GOGETOPT_HOST_OLD")
+	SetEnv("port", "TEST_GOGETOPT_PORT")
+	SetEnv("debug", "TEST_GOGETOPT_DEBUG")
+	SetEnv("verbose", "TEST_GOGETOPT_VERBOSE")
+
+	if SetEnv("nope", "TEST_GOGETOPT_NOPE") == nil {
+		t.Error("SetEnv() didn't fail for an unregistered key")
+	}
+
+	// Keep the usage on one line so the list can be checked in one piece
+	SetUsageWidth(0)
+	defer SetUsageWidth(DEFAULT_USAGE_WIDTH)
+
+	if !strings.Contains(GetUsage(), "(env: TEST_GOGETOPT_HOST, TEST_GOGETOPT_HOST_OLD)") {
+		t.Error("GetUsage() test: Environment variables weren't listed.  Got: " + GetUsage())
+	}
+
+	// The second variable is used when the first isn't set, and satisfies the required option
+	t.Setenv("TEST_GOGETOPT_HOST", "")
+	t.Setenv("TEST_GOGETOPT_HOST_OLD", "example.com")
+	t.Setenv("TEST_GOGETOPT_PORT", "8080")
+	t.Setenv("TEST_GOGETOPT_DEBUG", "yes")
+	t.Setenv("TEST_GOGETOPT_VERBOSE", "2")
+
+	ParseArgs([]string{"-p", "9090"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("host") != "example.com" {
+		t.Error("Parse() test: Didn't get the value from the environment.  Got: " + GetString("host"))
+	}
+
+	if GetString("port") != "9090" {
+		t.Error("Parse() test: Environment won over the command line.  Got: " + GetString("port"))
+	}
+
+	if !GetBool("debug") || GetCount("verbose") != 2 {
+		t.Errorf("Parse() test: Didn't get switches from the environment.  Got: %v, %d", GetBool("debug"), GetCount("verbose"))
+	}
+
+	// Environment values aren't command line options
+	for Next() {
+		if Opt().Key != "port" {
+			t.Error("Iterator test: Got an option which came from the environment: " + Opt().Key)
+		}
+	}
+
+	// Bad values name the variable
+	t.Setenv("TEST_GOGETOPT_DEBUG", "maybe")
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_INVALID_VAL) + ".*TEST_GOGETOPT_DEBUG")
+
+	ParseArgs([]string{})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get the right invalid value error, got: %v", GetError())
+	}
+
+	// Without the environment the required option is missing again
+	t.Setenv("TEST_GOGETOPT_HOST_OLD", "")
+	t.Setenv("TEST_GOGETOPT_DEBUG", "")
+
+	ParseArgs([]string{})
+	if !HasError() {
+		t.Error("Parse() test: Didn't get a parse error when missing required options.")
+	}
+}
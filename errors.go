@@ -0,0 +1,180 @@
+package gogetopt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// What went wrong in a ParseError.  Kinds work with errors.Is(), so a program can check for one
+// without digging the ParseError out first:
+//
+//	if errors.Is(err, gogetopt.KIND_REQ) {
+//		fmt.Println(gogetopt.GetUsage())
+//	}
+type ErrorKind int
+
+const (
+	// An option which wasn't registered (ERR_NO_OPT)
+	KIND_NO_OPT ErrorKind = iota
+
+	// An abbreviated long option which matches several (ERR_AMBIGUOUS_OPT)
+	KIND_AMBIGUOUS_OPT
+
+	// An option which takes a value was given without one (ERR_MISSING_VAL)
+	KIND_MISSING_VAL
+
+	// A switch was given a value it can't take (ERR_BOOL_WITH_VAL)
+	KIND_BOOL_WITH_VAL
+
+	// A value which couldn't be converted to the option's type, or which its Value turned down
+	// (ERR_INVALID_VAL)
+	KIND_INVALID_VAL
+
+	// An option with the DUP_ERROR policy was given more than once (ERR_DUPLICATE_OPT)
+	KIND_DUPLICATE_OPT
+
+	// A command name which wasn't registered (ERR_NO_CMD)
+	KIND_NO_CMD
+
+	// Required options weren't given anywhere (ERR_REQ)
+	KIND_REQ
+)
+
+// An error found while parsing, as returned by GetError().  Error() gives the same text parse errors
+// have always had, starting with one of the ERR_* constants, and the fields say what the error was
+// about.
+type ParseError struct {
+	Kind ErrorKind
+
+	// The key of the option the error is about, or "" if it isn't about a registered option, like an
+	// unknown one.  For KIND_REQ, the first missing option - Missing has all of them.
+	Key string
+
+	// The argument the error was found in, exactly as it was typed, and where it was in the parsed
+	// args.  For errors which didn't come from the command line, like a bad value in an environment
+	// variable or config file, Arg is "" and Index is -1.
+	Arg   string
+	Index int
+
+	// For KIND_REQ, the keys of every missing required option
+	Missing []string
+
+	// The error behind this one, if there was one, like the one from strconv or a Value's Set()
+	Err error
+
+	msg string
+}
+
+// Get the error text, which starts with one of the ERR_* constants
+func (e *ParseError) Error() string {
+	return e.msg
+}
+
+// Get the error behind this one, for errors.Is() and errors.As()
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Check if the error is of a kind, for errors.Is()
+func (e *ParseError) Is(target error) bool {
+	kind, ok := target.(ErrorKind)
+	return ok && kind == e.Kind
+}
+
+// Describe the kind of error, with the text of its ERR_* constant.  This makes an ErrorKind an error
+// itself, which is what lets errors.Is() match on it.
+func (k ErrorKind) Error() string {
+	switch k {
+	case KIND_NO_OPT:
+		return trimErr(ERR_NO_OPT)
+	case KIND_AMBIGUOUS_OPT:
+		return trimErr(ERR_AMBIGUOUS_OPT)
+	case KIND_MISSING_VAL:
+		return trimErr(ERR_MISSING_VAL)
+	case KIND_BOOL_WITH_VAL:
+		return trimErr(ERR_BOOL_WITH_VAL)
+	case KIND_INVALID_VAL:
+		return trimErr(ERR_INVALID_VAL)
+	case KIND_DUPLICATE_OPT:
+		return trimErr(ERR_DUPLICATE_OPT)
+	case KIND_NO_CMD:
+		return trimErr(ERR_NO_CMD)
+	case KIND_REQ:
+		return trimErr(ERR_REQ)
+	}
+	return "Unknown parse error"
+}
+
+//
+// Helpers
+//
+
+// Make a ParseError, about an option if there is one.  Where it happened is filled in by fail() for
+// errors found on the command line.
+func newParseError(kind ErrorKind, o *opt, msg string) *ParseError {
+	e := &ParseError{Kind: kind, Index: -1, msg: msg}
+	if o != nil {
+		e.Key = o.key
+	}
+	return e
+}
+
+// Record an error found in args[i].  Returns true if parsing has to stop, which it does on the first
+// error unless errors are being collected.  A missing command always stops it, since there's no
+// telling what the rest of the arguments were meant for.
+func (p *Parser) fail(err error, i int) bool {
+	e, ok := err.(*ParseError)
+	if ok {
+		e.Arg = p.args[i]
+		e.Index = i
+	}
+	p.addError(err)
+
+	return !p.collecting() || !ok || e.Kind == KIND_NO_CMD
+}
+
+// Record an error as the parse error.  When errors are being collected it's added to the ones found
+// so far, and the parse error becomes all of them joined together if there's more than one.
+func (p *Parser) addError(err error) {
+	if p.collecting() {
+		p.parseErrors = append(p.parseErrors, err)
+	} else {
+		p.parseErrors = []error{err}
+	}
+
+	p.parseError = joinErrors(p.parseErrors)
+}
+
+// Combine errors into one: nil for none, the error itself for one, and errors.Join() for more
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// Check if parsing carries on past errors.  Commands go by the parser at the top of the tree.
+func (p *Parser) collecting() bool {
+	return p.root().collectErrors
+}
+
+// Add text to either end of an error's message, to say where the bad value came from.  ParseErrors
+// stay ParseErrors.
+func withContext(err error, prefix string, suffix string) error {
+	e, ok := err.(*ParseError)
+	if !ok {
+		return fmt.Errorf("%s%w%s", prefix, err, suffix)
+	}
+
+	e.msg = prefix + e.msg + suffix
+	return e
+}
+
+// Take the ": " off the end of an ERR_* constant
+func trimErr(msg string) string {
+	return strings.TrimSuffix(msg, ": ")
+}
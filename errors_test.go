@@ -0,0 +1,222 @@
+package gogetopt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Parse errors say what went wrong and where, and keep their old text
+func TestParseErrors(t *testing.T) {
+	p := NewParser()
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "test usage")
+	regErr = p.RegisterOpt("file", "file", "f", false, true, "test usage")
+	regErr = p.RegisterOpt("name", "name", "n", false, true, "test usage")
+	regErr = p.RegisterTypedOpt("count", "count", "c", TYPE_INT, false, "test usage")
+	regErr = p.RegisterOpt("once", "once", "", false, false, "test usage")
+
+	if regErr != nil {
+		t.Fatal("Parse() test: Got reg error: " + regErr.Error())
+	}
+
+	p.SetDuplicatePolicy("once", DUP_ERROR)
+	p.SetEnv("count", "TEST_GOGETOPT_COUNT")
+	p.AddCommand("deploy", "test usage", nil)
+
+	tests := []struct {
+		args  []string
+		kind  ErrorKind
+		key   string
+		arg   string
+		index int
+		msg   string
+	}{
+		{[]string{"-f", "a", "-n", "b", "--nope"}, KIND_NO_OPT, "", "--nope", 4, ERR_NO_OPT + "--nope"},
+		{[]string{"-f", "a", "-n", "b", "-vx"}, KIND_NO_OPT, "", "-vx", 4, ERR_NO_OPT + "-x"},
+		{[]string{"-n", "b", "--file"}, KIND_MISSING_VAL, "file", "--file", 2, ERR_MISSING_VAL + "--file"},
+		{[]string{"-f", "a", "-n", "b", "--verbose=maybe"}, KIND_BOOL_WITH_VAL, "verbose", "--verbose=maybe", 4, ERR_BOOL_WITH_VAL + "--verbose=maybe"},
+		{[]string{"-f", "a", "-n", "b", "-c", "lots"}, KIND_INVALID_VAL, "count", "-c", 4, ERR_INVALID_VAL + "-c or --count expects int, got: lots"},
+		{[]string{"--once", "1", "--once=2"}, KIND_DUPLICATE_OPT, "once", "--once=2", 2, ERR_DUPLICATE_OPT + "--once"},
+		{[]string{"-f", "a", "-n", "b", "destroy"}, KIND_NO_CMD, "", "destroy", 4, ERR_NO_CMD + "destroy"},
+		{[]string{"-v"}, KIND_REQ, "file", "", -1, ERR_REQ + "-f or --file, -n or --name"},
+	}
+
+	for _, test := range tests {
+		p.ParseArgs(test.args)
+		err := p.GetError()
+
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Parse() test: Didn't get a ParseError for %v, got: %v", test.args, err)
+			continue
+		}
+
+		if pe.Kind != test.kind || pe.Key != test.key || pe.Arg != test.arg || pe.Index != test.index {
+			t.Errorf("Parse() test: Wrong ParseError for %v, got: %+v", test.args, *pe)
+		}
+
+		if err.Error() != test.msg {
+			t.Error("Parse() test: Error text changed.  Expected: " + test.msg + " Got: " + err.Error())
+		}
+
+		if !errors.Is(err, test.kind) {
+			t.Errorf("Parse() test: errors.Is() didn't match the kind for %v", test.args)
+		}
+
+		if test.kind != KIND_NO_OPT && errors.Is(err, KIND_NO_OPT) {
+			t.Errorf("Parse() test: errors.Is() matched the wrong kind for %v", test.args)
+		}
+	}
+
+	// Every missing required option is listed
+	p.ParseArgs([]string{})
+	var pe *ParseError
+	errors.As(p.GetError(), &pe)
+	if len(pe.Missing) != 2 || pe.Missing[0] != "file" || pe.Missing[1] != "name" {
+		t.Errorf("Parse() test: Wrong missing options, got: %v", pe.Missing)
+	}
+
+	// The error from the conversion is kept
+	p.ParseArgs([]string{"-f", "a", "-n", "b", "--count=lots"})
+	if !errors.Is(p.GetError(), strconv.ErrSyntax) {
+		t.Errorf("Parse() test: Conversion error wasn't kept, got: %v", p.GetError())
+	}
+
+	// Errors from the environment don't have a place in the args
+	t.Setenv("TEST_GOGETOPT_COUNT", "lots")
+	p.ParseArgs([]string{"-f", "a", "-n", "b"})
+	if !errors.As(p.GetError(), &pe) || pe.Kind != KIND_INVALID_VAL || pe.Index != -1 || pe.Arg != "" {
+		t.Errorf("Parse() test: Wrong ParseError for a bad environment variable, got: %v", p.GetError())
+	}
+
+	expected := ERR_INVALID_VAL + "-c or --count expects int, got: lots (from environment variable TEST_GOGETOPT_COUNT)"
+	if p.GetError().Error() != expected {
+		t.Error("Parse() test: Error text changed.  Expected: " + expected + " Got: " + p.GetError().Error())
+	}
+
+	if KIND_REQ.Error() != "Required option(s) not provided" {
+		t.Error("ErrorKind test: Wrong text for a kind: " + KIND_REQ.Error())
+	}
+}
+
+// With errors collected, everything wrong with the args is reported in one go
+func TestCollectErrors(t *testing.T) {
+	p := NewParser()
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "test usage")
+	regErr = p.RegisterOpt("file", "file", "f", false, true, "test usage")
+	regErr = p.RegisterOpt("name", "name", "n", false, false, "test usage")
+	regErr = p.RegisterTypedOpt("count", "count", "c", TYPE_INT, false, "test usage")
+
+	if regErr != nil {
+		t.Fatal("Parse() test: Got reg error: " + regErr.Error())
+	}
+
+	deploy, _ := p.AddCommand("deploy", "test usage", nil)
+	deploy.RegisterTypedOpt("port", "port", "p", TYPE_UINT, false, "test usage")
+
+	args := []string{"--nope", "-c", "lots", "-n", "b", "--verbose=maybe", "-vx", "-c", "3", "--name"}
+
+	// Off by default, so only the first one is reported
+	p.ParseArgs(args)
+	var pe *ParseError
+	if !errors.As(p.GetError(), &pe) || pe.Kind != KIND_NO_OPT || p.GetError().Error() != ERR_NO_OPT+"--nope" {
+		t.Errorf("Parse() test: Expected only the first error, got: %v", p.GetError())
+	}
+
+	p.SetCollectErrors(true)
+	p.ParseArgs(args)
+
+	joined, ok := p.GetError().(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Parse() test: Errors weren't joined, got: %v", p.GetError())
+	}
+
+	expected := []struct {
+		kind  ErrorKind
+		index int
+	}{
+		{KIND_NO_OPT, 0},
+		{KIND_INVALID_VAL, 1},
+		{KIND_BOOL_WITH_VAL, 5},
+		{KIND_NO_OPT, 6},
+		{KIND_MISSING_VAL, 9},
+		{KIND_REQ, -1},
+	}
+
+	errs := joined.Unwrap()
+	if len(errs) != len(expected) {
+		t.Fatalf("Parse() test: Expected %d errors, got: %v", len(expected), errs)
+	}
+
+	for i, err := range errs {
+		if !errors.As(err, &pe) || pe.Kind != expected[i].kind || pe.Index != expected[i].index {
+			t.Errorf("Parse() test: Wrong error %d, got: %v", i, err)
+		}
+	}
+
+	// Parsing carried on around the errors
+	if p.GetString("name") != "b" || p.GetInt("count") != 3 {
+		t.Error("Parse() test: Values after an error weren't parsed")
+	}
+
+	if !errors.Is(p.GetError(), KIND_MISSING_VAL) || errors.Is(p.GetError(), KIND_DUPLICATE_OPT) {
+		t.Error("Parse() test: errors.Is() didn't look through the joined errors")
+	}
+
+	// A single error isn't joined
+	p.ParseArgs([]string{"-f", "a", "--nope"})
+	if !errors.As(p.GetError(), &pe) || p.GetError() != error(pe) {
+		t.Errorf("Parse() test: Expected a lone ParseError, got: %v", p.GetError())
+	}
+
+	// Commands report theirs along with the parent's
+	p.ParseArgs([]string{"--nope", "deploy", "-p", "lots", "--nope"})
+	joined, ok = p.GetError().(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 4 {
+		t.Fatalf("Parse() test: Expected 4 errors through a command, got: %v", p.GetError())
+	}
+
+	errs = joined.Unwrap()
+	if !errors.Is(errs[1], KIND_INVALID_VAL) || !errors.Is(errs[2], KIND_NO_OPT) || !errors.Is(errs[3], KIND_REQ) {
+		t.Errorf("Parse() test: Wrong errors through a command, got: %v", errs)
+	}
+
+	// An unknown command still stops everything
+	p.ParseArgs([]string{"-f", "a", "-c", "lots", "destroy", "--nope"})
+	joined, ok = p.GetError().(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 || !errors.Is(joined.Unwrap()[1], KIND_NO_CMD) {
+		t.Errorf("Parse() test: Expected to stop at the unknown command, got: %v", p.GetError())
+	}
+
+	// No errors, no error
+	p.ParseArgs([]string{"-f", "a"})
+	if p.HasError() {
+		t.Error("Parse() test: Got an error when there were none: " + p.GetError().Error())
+	}
+
+	// Every bad value from the environment is reported, not just the first
+	p.SetEnv("verbose", "TEST_GOGETOPT_VERBOSE")
+	p.SetEnv("count", "TEST_GOGETOPT_COUNT")
+	t.Setenv("TEST_GOGETOPT_VERBOSE", "maybe")
+	t.Setenv("TEST_GOGETOPT_COUNT", "lots")
+
+	p.ParseArgs([]string{"--nope"})
+	joined, ok = p.GetError().(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 4 {
+		t.Fatalf("Parse() test: Expected 4 errors with the environment, got: %v", p.GetError())
+	}
+
+	errs = joined.Unwrap()
+	if !errors.Is(errs[0], KIND_NO_OPT) || !errors.Is(errs[1], KIND_INVALID_VAL) || !errors.Is(errs[2], KIND_INVALID_VAL) || !errors.Is(errs[3], KIND_REQ) {
+		t.Errorf("Parse() test: Wrong errors with the environment, got: %v", errs)
+	}
+
+	if !strings.Contains(errs[1].Error(), "TEST_GOGETOPT_VERBOSE") || !strings.Contains(errs[2].Error(), "TEST_GOGETOPT_COUNT") {
+		t.Errorf("Parse() test: Environment errors don't name their variables, got: %v", errs)
+	}
+}
@@ -6,18 +6,48 @@
 //
 // Instead options are created via RegisterOpt(), where you explicitly state whether or not an option
 // is required and whether or not it takes a value or is just a boolean switch.  You can define both
-// a long (--switch) and short (-s) for the same option.
+// a long (--switch) and short (-s) for the same option.  Options whose value can be left off (what
+// "f::" used to mean) are created with RegisterOptionalOpt() instead, and options which can be given
+// several times with every value kept (-I dir1 -I dir2) are created with RegisterMultiOpt().
+//
+// By default, when an option is given more than once the last value wins.  SetDuplicatePolicy() changes
+// this per option, to keep the first value, keep every value or treat the repeat as a parse error.
+// Switches registered with RegisterCounterOpt() count their appearances instead (-vvv for more verbosity)
+// and can be paired with a switch registered with RegisterDecrementOpt() which counts down (-q).
+//
+// Values are strings unless the option is registered with RegisterTypedOpt(), in which case they're
+// converted while parsing and read back with GetInt(), GetInt64(), GetUint(), GetFloat64(), GetDuration()
+// or GetBool().  A value which can't be converted is a parse error.  For any other type, implement the
+// Value interface (the same one the standard flag package uses) and register it with RegisterValueOpt().
+//
+// Any option which takes a value can have a default set with SetDefault().  The getters return it when the
+// option isn't given, and Lookup() tells you whether the value was actually given or is the default.
+// Options can also be bound to environment variables with SetEnv().  When the option isn't on the
+// command line, Parse() uses the first of those variables which is set, and that counts towards
+// required options.  The command line always wins over the environment.
+//
+// Options can be set from INI-style or JSON config files as well, with LoadConfigFile().  These come after
+// the environment, so the order of precedence is command line, environment, config files and then defaults.
+// GetSource() tells you which of these an option's value actually came from.
 //
 // Once registered, call Parse() which will read the current command line args and compare them to
 // which opts were registered.  If they are found, the calling program can get the values with GetBool()
-// and GetString().
+// and GetString().  To parse a list of arguments which didn't come from the command line, use ParseArgs()
+// instead and pass it the arguments without the program name.
+//
+// The package-level functions all work against a single default option set.  If you need more than one
+// set of options in the same program, create a Parser with NewParser() and use its methods instead, which
+// mirror the package-level functions exactly.
 //
 // If there were any errors which occurred during option registration, they will be returned at the time
 // of reg.
 //
-// Parsing errors work a bit differently.  Parsing will halt on the first error encountered.  You can check
+// Parsing errors work a bit differently.  Parsing will halt on the first error encountered, unless
+// SetCollectErrors(true) has been called, in which case it carries on and reports them all.  You can check
 // for a parse error with HasError() and if it returns true use GetError() to get the error object.  Alternatively
-// just call GetError() and check if it isn't nil.  Whichever you like better.
+// just call GetError() and check if it isn't nil.  Whichever you like better.  The error is a *ParseError,
+// which says what kind of error it was and which option and argument it was about.  Use errors.As() to get
+// at it, or errors.Is() with one of the KIND_* constants to check the kind.
 //
 // Accepted forms of options:
 //
@@ -29,6 +59,37 @@
 // --long val       (string longopt)
 // -fbx             (combined boolean shortopts)
 // -fVAL            (string shortopt, no space or = sign)
+// -bxfVAL          (combined shortopts, the first non-boolean one takes the rest as its value)
+// -bxf VAL         (combined shortopts ending in a non-boolean one, value is the next arg)
+// --long / -l      (optional value shortopt or longopt given without its value)
+// --long=false     (boolean longopt with an explicit true/false, yes/no or 1/0, also -l=false)
+// --no-long        (turns off a boolean longopt which was made negatable with SetNegatable())
+// --               (ends option processing, everything after it is an extra argument)
+//
+// By default options can appear anywhere on the command line, before or after non-option arguments.  Use
+// SetParseMode() to have option processing stop at the first non-option argument instead, which is what
+// wrapper commands like "prog [opts] subprogram [subprogram-opts]" need.
+//
+// Long options must normally be spelled out in full.  SetAllowAbbrev() turns on GNU-style abbreviation,
+// where any unambiguous prefix of a long option (--verb for --verbose) is accepted.
+//
+// GetBool() and GetString() only tell you the final state of each option.  To see every option in the
+// order it was given, repeats included, loop over the results with Next() and Opt() the way you would
+// with getopt().
+//
+// GetUsage() builds the help text: a "Usage:" line with the program name, then the options in the order
+// they were registered with their descriptions lined up and wrapped.  SetProgName(), SetArgsUsage() and
+// SetUsageWidth() adjust it, SetMetavar() names an option's value, BeginGroup() starts a titled section of
+// options, and SetDescription() and SetEpilog() add text before and after the options.  GetManPage()
+// builds a roff man page from the same information, and SetHidden() leaves an option out of both.
+// GetCompletionScript() writes tab completion scripts for bash, zsh and fish, with SetCompletion() marking
+// the options whose values are file or directory names.  For values only the program knows, like branch
+// names, register a CompletionFunc with SetCompletionFunc() and call HandleCompletion() at the start of
+// main().  The scripts then run the program with a hidden "__complete" argument to ask for them.
+//
+// Programs like "git" which have subcommands can add them with AddCommand().  Each command is a Parser of
+// its own with its own options, and options marked with SetPersistent() work in a parser's commands too.
+// RunArgs() and Run() parse and then call the handler of the command which was chosen.
 //
 // Any non-boolean option can be set to required, which will result in a parse error state if the option isn't
 // found
@@ -42,6 +103,8 @@ import (
 	"errors"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -52,12 +115,116 @@ type opt struct {
 	isBool   bool
 	required bool
 	usage    string
+
+	// Options with an optional value, and what they're set to when it's left off
+	isOptional  bool
+	implicitVal string
+
+	// What to do when the option is given more than once
+	dupPolicy DuplicatePolicy
+
+	// What kind of value the option takes, for options which aren't switches.  Options backed by a
+	// user-supplied Value have that instead.
+	valType OptType
+	value   Value
+
+	// The value used when the option isn't given, both as given and converted to the option's type
+	hasDefault   bool
+	defVal       string
+	defConverted interface{}
+
+	// Environment variables to check, in order, when the option isn't on the command line
+	envVars []string
+
+	// Counting switches, which counter they change and by how much
+	isCounter  bool
+	counterKey string
+	step       int
+
+	// For a switch which can be turned off with --no-<long>, the stand-in option registered under that
+	// name.  The stand-in points back to the switch it turns off.
+	negation *opt
+	negates  *opt
+
+	// The parser the option was registered on, and whether that parser's commands can use it too
+	owner      *Parser
+	persistent bool
+
+	// How the value is named in usage, the usage section the option was registered in, and whether
+	// it's left out of usage altogether
+	metavar string
+	group   string
+	hidden  bool
+
+	// What shell completion offers for the option's value, and the program's function for working
+	// it out at completion time
+	completion   CompletionKind
+	completeFunc CompletionFunc
 }
 
-var (
+// Controls how options and non-option arguments are allowed to mix on the command line.
+type ParseMode int
+
+const (
+	// Options are recognized anywhere on the command line, even after non-option arguments.  This
+	// is the default.
+	MODE_PERMUTE ParseMode = iota
+
+	// The first non-option argument ends option processing, the same as GNU getopt() with a leading
+	// "+" in its optstring.  Everything from that argument on goes into the extra args untouched.
+	MODE_REQUIRE_ORDER
+
+	// Behaves like MODE_REQUIRE_ORDER if the POSIXLY_CORRECT environment variable is set and like
+	// MODE_PERMUTE otherwise.  The environment is checked each time the parser runs.
+	MODE_POSIXLY_CORRECT
+
+	// Options are recognized anywhere like MODE_PERMUTE, but the iterator also hands back each
+	// non-option argument in its place, the same as GNU getopt() with a leading "-" in its optstring.
+	MODE_RETURN_IN_ORDER
+)
+
+// Controls what happens when an option is given more than once on the command line.
+type DuplicatePolicy int
+
+const (
+	// Each appearance replaces the value of the one before it.  This is the default.
+	DUP_LAST_WINS DuplicatePolicy = iota
+
+	// Only the first appearance sets the value, later ones are ignored.
+	DUP_FIRST_WINS
+
+	// Giving the option more than once is a parse error.
+	DUP_ERROR
+
+	// Every value is kept, in the order given, and can be read back with GetStrings().  GetString()
+	// returns the last one.
+	DUP_APPEND
+)
+
+// A single option found on the command line, as handed back by the Next()/Opt() iterator.  An option
+// which appears more than once shows up once for every appearance.
+type Option struct {
+	// The key the option was registered with.  In MODE_RETURN_IN_ORDER this is empty for non-option
+	// arguments.
+	Key string
+
+	// The value given with the option, or the argument itself for a non-option argument.  Empty
+	// for boolean switches, unless the switch was given an explicit value or negated with --no-<long>,
+	// in which case it's "true" or "false".
+	Value string
+
+	// Where the option was found in the parsed args
+	Index int
+}
 
-	// Master table and lookup tables
+// A Parser holds a set of registered options along with the results of parsing a command line
+// against them.  Each Parser is independent of every other, so a program can keep as many option
+// sets around as it needs.  The package-level functions all operate on a default Parser.
+type Parser struct {
+
+	// Master table and lookup tables, plus every option in the order it was registered
 	opts         map[string]*opt
+	order        []*opt
 	shortKeys    map[string]*opt
 	longKeys     map[string]*opt
 	requiredOpts map[string]bool
@@ -65,16 +232,79 @@ var (
 	// Value holders
 	boolVals   map[string]bool
 	stringVals map[string]string
+	multiVals  map[string][]string
+	typedVals  map[string]interface{}
+	counts     map[string]int
+	sources    map[string]Source
+	args       []string
 	extraArgs  []string
+	foundReqs  map[string]bool
+
+	// Every option found, in command line order, and the iterator's position in them
+	occurrences []*Option
+	cursor      int
+
+	// How options and non-options can be mixed
+	mode ParseMode
+
+	// Whether long options can be given as an unambiguous prefix
+	allowAbbrev bool
+
+	// Whether parsing carries on past errors it can recover from, see SetCollectErrors()
+	collectErrors bool
+
+	// Where the "--" terminator was found in the parsed args, -1 if it wasn't
+	terminator int
+
+	// Values loaded from config files, by option key
+	configVals map[string]*configVal
+
+	// Whether the parser has been run, so late config files know to apply their values
+	parsed bool
+
+	// Commands, for parsers which have them, and for a parser which is a command, its name, usage,
+	// the parser it belongs to and what to run when it's chosen.  command is the one chosen by the
+	// last parse.
+	commands     map[string]*Parser
+	commandOrder []*Parser
+	command      *Parser
+	name         string
+	cmdUsage     string
+	parent       *Parser
+	handler      func(*Parser) error
+
+	// Usage settings: the program name and args for the synopsis line, and the width to wrap at
+	progName     string
+	argsUsage    string
+	hasArgsUsage bool
+	usageWidth   int
+	description  string
+	epilog       string
+
+	// The usage section options registered now go in, see BeginGroup()
+	group string
+
+	// The program's function for completing non-option args, and while Complete() is running, what
+	// it's looking for
+	argsCompleteFunc CompletionFunc
+	completing       *completion
+
+	// Error holders: every error found, and the one GetError() returns, which joins them if there's
+	// more than one
+	parseError  error
+	parseErrors []error
+}
+
+var (
+
+	// The parser used by the package-level functions
+	defaultParser *Parser
 
 	// Regexes
 	singleDash       *regexp.Regexp
 	multiDash        *regexp.Regexp
 	singleDashEquals *regexp.Regexp
 	multiDashEquals  *regexp.Regexp
-
-	// Error holder
-	parseError string
 )
 
 const (
@@ -83,41 +313,206 @@ const (
 	ERR_BOOL_REQ               string = "An option can't be both boolean and required: "
 	ERR_REQ                    string = "Required option(s) not provided: "
 	ERR_BOOL_WITH_VAL          string = "Boolean options can't be passed values: "
-	ERR_NONBOOL_MULTI          string = "Combined opts can't be non-boolean: "
+	ERR_NONBOOL_MULTI          string = "Combined opts can't be non-boolean: " // no longer returned by Parse()
 	ERR_NO_KEY                 string = "An option must contain either a long or short key (or both): "
 	ERR_SHORT_TOO_LONG         string = "A short option can be no longer one character: "
 	ERR_LONG_TOO_SHORT         string = "A long option must be longer than one character: "
 	ERR_OPT_KEY_ALREADY_EXISTS string = "An option was already registered with key: "
 	ERR_SHORT_ALREADY_EXISTS   string = "An option was already registered with short key: "
 	ERR_LONG_ALREADY_EXISTS    string = "An option was already registered with long key: "
+	ERR_AMBIGUOUS_OPT          string = "Ambiguous option: "
+	ERR_DUPLICATE_OPT          string = "Option can only be given once: "
+	ERR_NOT_COUNTER            string = "Not a counter option: "
+	ERR_NOT_NEGATABLE          string = "Only boolean options with a long key can be negated: "
+	ERR_INVALID_VAL            string = "Invalid value for option: "
+	ERR_BOOL_DEFAULT           string = "Boolean options can't have a default value: "
+	ERR_NO_CMD                 string = "No such command: "
+	ERR_CMD_ALREADY_EXISTS     string = "A command was already registered with name: "
 )
 
 func init() {
-	opts = make(map[string]*opt)
-	shortKeys = make(map[string]*opt)
-	longKeys = make(map[string]*opt)
-	requiredOpts = make(map[string]bool)
-
-	boolVals = make(map[string]bool)
-	stringVals = make(map[string]string)
-	extraArgs = make([]string, 0)
-
 	singleDash = regexp.MustCompile("^-.+")
 	multiDash = regexp.MustCompile("^--.+")
 	singleDashEquals = regexp.MustCompile("^-.+=")
 	multiDashEquals = regexp.MustCompile("^--.+=")
 
-	parseError = ""
+	defaultParser = NewParser()
 }
 
 //
 // PUBLIC API
 //
 
+// Create a new, empty Parser with no registered options.
+func NewParser() *Parser {
+	p := new(Parser)
+	p.opts = make(map[string]*opt)
+	p.shortKeys = make(map[string]*opt)
+	p.longKeys = make(map[string]*opt)
+	p.requiredOpts = make(map[string]bool)
+	p.order = make([]*opt, 0)
+	p.configVals = make(map[string]*configVal)
+	p.commands = make(map[string]*Parser)
+	p.commandOrder = make([]*Parser, 0)
+	p.usageWidth = DEFAULT_USAGE_WIDTH
+
+	p.resetResults()
+	return p
+}
+
+// Register an option on the default parser.  See Parser.RegisterOpt().
+func RegisterOpt(key, long, short string, isBool, isReq bool, usage string) error {
+	return defaultParser.RegisterOpt(key, long, short, isBool, isReq, usage)
+}
+
+// Register an optional-value option on the default parser.  See Parser.RegisterOptionalOpt().
+func RegisterOptionalOpt(key, long, short string, implicitVal string, isReq bool, usage string) error {
+	return defaultParser.RegisterOptionalOpt(key, long, short, implicitVal, isReq, usage)
+}
+
+// Register a repeatable option on the default parser.  See Parser.RegisterMultiOpt().
+func RegisterMultiOpt(key, long, short string, isReq bool, usage string) error {
+	return defaultParser.RegisterMultiOpt(key, long, short, isReq, usage)
+}
+
+// Register a counting switch on the default parser.  See Parser.RegisterCounterOpt().
+func RegisterCounterOpt(key, long, short string, usage string) error {
+	return defaultParser.RegisterCounterOpt(key, long, short, usage)
+}
+
+// Register a decrementing switch on the default parser.  See Parser.RegisterDecrementOpt().
+func RegisterDecrementOpt(key, counterKey, long, short string, usage string) error {
+	return defaultParser.RegisterDecrementOpt(key, counterKey, long, short, usage)
+}
+
+// Make a switch negatable on the default parser.  See Parser.SetNegatable().
+func SetNegatable(key string) error {
+	return defaultParser.SetNegatable(key)
+}
+
+// Set an option's default on the default parser.  See Parser.SetDefault().
+func SetDefault(key, val string) error {
+	return defaultParser.SetDefault(key, val)
+}
+
+// Set an option's duplicate policy on the default parser.  See Parser.SetDuplicatePolicy().
+func SetDuplicatePolicy(key string, policy DuplicatePolicy) error {
+	return defaultParser.SetDuplicatePolicy(key, policy)
+}
+
+// Remove all options from the default parser.  See Parser.ClearAll().
+func ClearAll() {
+	defaultParser.ClearAll()
+}
+
+// Remove a single option from the default parser.  See Parser.Clear().
+func Clear(key string) {
+	defaultParser.Clear(key)
+}
+
+// Set the parse mode of the default parser.  See Parser.SetParseMode().
+func SetParseMode(mode ParseMode) {
+	defaultParser.SetParseMode(mode)
+}
+
+// Allow abbreviated long options on the default parser.  See Parser.SetAllowAbbrev().
+func SetAllowAbbrev(allow bool) {
+	defaultParser.SetAllowAbbrev(allow)
+}
+
+// Collect every parse error on the default parser.  See Parser.SetCollectErrors().
+func SetCollectErrors(collect bool) {
+	defaultParser.SetCollectErrors(collect)
+}
+
+// Get a string value from the default parser.  See Parser.GetString().
+func GetString(key string) string {
+	return defaultParser.GetString(key)
+}
+
+// Get a string value and whether it was given from the default parser.  See Parser.Lookup().
+func Lookup(key string) (string, bool) {
+	return defaultParser.Lookup(key)
+}
+
+// Get all of an option's values from the default parser.  See Parser.GetStrings().
+func GetStrings(key string) []string {
+	return defaultParser.GetStrings(key)
+}
+
+// Get a bool value and whether it was given from the default parser.  See Parser.LookupBool().
+func LookupBool(key string) (bool, bool) {
+	return defaultParser.LookupBool(key)
+}
+
+// Get a counter value from the default parser.  See Parser.GetCount().
+func GetCount(key string) int {
+	return defaultParser.GetCount(key)
+}
+
+// Get a bool value from the default parser.  See Parser.GetBool().
+func GetBool(key string) bool {
+	return defaultParser.GetBool(key)
+}
+
+// Get the extra arguments from the default parser.  See Parser.GetArgs().
+func GetArgs() []string {
+	return defaultParser.GetArgs()
+}
+
+// Get the terminator position from the default parser.  See Parser.GetTerminatorIndex().
+func GetTerminatorIndex() int {
+	return defaultParser.GetTerminatorIndex()
+}
+
+// Get the args after the terminator from the default parser.  See Parser.GetArgsAfterTerminator().
+func GetArgsAfterTerminator() []string {
+	return defaultParser.GetArgsAfterTerminator()
+}
+
+// Advance the default parser's option iterator.  See Parser.Next().
+func Next() bool {
+	return defaultParser.Next()
+}
+
+// Get the default parser's current option.  See Parser.Opt().
+func Opt() *Option {
+	return defaultParser.Opt()
+}
+
+// Check the default parser for a parse error.  See Parser.HasError().
+func HasError() bool {
+	return defaultParser.HasError()
+}
+
+// Get the default parser's parse error.  See Parser.GetError().
+func GetError() error {
+	return defaultParser.GetError()
+}
+
+// Get the usage for the default parser's options.  See Parser.GetUsage().
+func GetUsage() string {
+	return defaultParser.GetUsage()
+}
+
+// Parse the command line with the default parser.  See Parser.Parse().
+func Parse() {
+	defaultParser.Parse()
+}
+
+// Parse an argument list with the default parser.  See Parser.ParseArgs().
+func ParseArgs(args []string) {
+	defaultParser.ParseArgs(args)
+}
+
+//
+// PARSER METHODS
+//
+
 // Register an option to the list of options which will be parsed.  An option can have both
 // a long and short val, and it will respond to either form on the command line.  If you only
 // want one form to work, just push in an empty string.
-func RegisterOpt(key, long, short string, isBool, isReq bool, usage string) error {
+func (p *Parser) RegisterOpt(key, long, short string, isBool, isReq bool, usage string) error {
 	o := new(opt)
 	o.key = key
 	o.long = stripDashes(long)
@@ -126,6 +521,163 @@ func RegisterOpt(key, long, short string, isBool, isReq bool, usage string) erro
 	o.required = isReq
 	o.usage = usage
 
+	return p.register(o)
+}
+
+// Register an option whose value is optional, like getopt()'s "f::".  Given on its own (--color or -O)
+// the option is set to implicitVal.  A value attached with an equals sign (--color=always, -O=2) or
+// directly after a short option (-O2) overrides it.  A value in the following, separate argument is
+// never taken, so "--color always" sets the option to implicitVal and leaves "always" as an extra arg.
+func (p *Parser) RegisterOptionalOpt(key, long, short string, implicitVal string, isReq bool, usage string) error {
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.isOptional = true
+	o.implicitVal = implicitVal
+	o.required = isReq
+	o.usage = usage
+
+	return p.register(o)
+}
+
+// Register an option which can be given any number of times, keeping every value in the order given.
+// This is the same as registering a value option with RegisterOpt() and setting its duplicate policy to
+// DUP_APPEND.  Read the values back with GetStrings().
+func (p *Parser) RegisterMultiOpt(key, long, short string, isReq bool, usage string) error {
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.required = isReq
+	o.usage = usage
+	o.dupPolicy = DUP_APPEND
+
+	return p.register(o)
+}
+
+// Register a boolean switch which counts how many times it was given, so -vvv or --verbose --verbose
+// --verbose can mean more than just -v.  Appearances inside combined shortopts count too.  Read the
+// count back with GetCount().  GetBool() is true if the switch was given at all.
+func (p *Parser) RegisterCounterOpt(key, long, short string, usage string) error {
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.isBool = true
+	o.usage = usage
+	o.isCounter = true
+	o.counterKey = key
+	o.step = 1
+
+	return p.register(o)
+}
+
+// Register a boolean switch which lowers another option's count by one every time it's given, like a
+// -q to go with a -v.  The counter has to be registered first with RegisterCounterOpt().  GetCount()
+// on the counter's key gives the combined result, which can go below zero.
+func (p *Parser) RegisterDecrementOpt(key, counterKey, long, short string, usage string) error {
+	counter, ok := p.opts[counterKey]
+	if !ok || !counter.isCounter || counter.step < 0 {
+		return errors.New(ERR_NOT_COUNTER + counterKey)
+	}
+
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.isBool = true
+	o.usage = usage
+	o.isCounter = true
+	o.counterKey = counterKey
+	o.step = -1
+
+	return p.register(o)
+}
+
+// Let a boolean switch be turned off from the command line with --no-<long>, for when a default or
+// another source has turned it on.  The switch must have a long key.  Once turned off, GetBool() is
+// false and LookupBool() reports that the switch was given.
+func (p *Parser) SetNegatable(key string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	if !o.isBool || o.isCounter || o.long == "" {
+		return errors.New(ERR_NOT_NEGATABLE + key)
+	}
+
+	// Already done
+	if o.negation != nil {
+		return nil
+	}
+
+	n := new(opt)
+	n.key = o.key
+	n.long = "no-" + o.long
+	n.isBool = true
+	n.negates = o
+	n.owner = p
+
+	_, lPres := p.longKeys[n.long]
+	if lPres {
+		return errors.New(ERR_LONG_ALREADY_EXISTS + n.long)
+	}
+
+	p.longKeys[n.long] = n
+	o.negation = n
+	return nil
+}
+
+// Set the value an option has when it isn't given.  GetString() and the typed getters return it
+// for an absent option, GetUsage() shows it, and Lookup() still reports the option as not given.
+// Typed options must be given a default which converts to their type, and Value-backed options have
+// the default passed to Set() right away.  Switches can't have defaults.
+func (p *Parser) SetDefault(key, val string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	if o.isBool {
+		return errors.New(ERR_BOOL_DEFAULT + key)
+	}
+
+	converted, err := convertVal(o, val)
+	if err != nil {
+		return err
+	}
+
+	if o.value != nil {
+		err = o.value.Set(val)
+		if err != nil {
+			return errors.New(ERR_INVALID_VAL + optDisplayName(o) + ": " + err.Error())
+		}
+	}
+
+	o.hasDefault = true
+	o.defVal = val
+	o.defConverted = converted
+	return nil
+}
+
+// Set what happens when an option is given more than once.  See the DUP_* constants.  For a switch,
+// DUP_FIRST_WINS keeps whatever the first appearance set it to (so --verbose=false --verbose stays
+// off), and DUP_APPEND is the same as DUP_LAST_WINS since there's only ever one value to keep.
+func (p *Parser) SetDuplicatePolicy(key string, policy DuplicatePolicy) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.dupPolicy = policy
+	return nil
+}
+
+// Check a newly built option for problems and add it to the lookup tables if there aren't any.
+func (p *Parser) register(o *opt) error {
+
 	// Error condition - can't make a switch be both required and boolean
 	if o.isBool && o.required {
 		return errors.New(ERR_BOOL_REQ + o.key)
@@ -148,38 +700,41 @@ func RegisterOpt(key, long, short string, isBool, isReq bool, usage string) erro
 
 	// Check for already existing keys registered (main key, short and long)
 
-	_, oPres := opts[o.key]
+	_, oPres := p.opts[o.key]
 	if oPres {
 		return errors.New(ERR_OPT_KEY_ALREADY_EXISTS + o.key)
 	}
 
 	if o.short != "" {
-		_, sPres := shortKeys[o.short]
+		_, sPres := p.shortKeys[o.short]
 		if sPres {
 			return errors.New(ERR_SHORT_ALREADY_EXISTS + o.short)
 		}
 	}
 
 	if o.long != "" {
-		_, lPres := longKeys[o.long]
+		_, lPres := p.longKeys[o.long]
 		if lPres {
 			return errors.New(ERR_LONG_ALREADY_EXISTS + o.long)
 		}
 	}
 
 	// Assign the option to the various maps as applicable
-	opts[o.key] = o
+	o.owner = p
+	o.group = p.group
+	p.opts[o.key] = o
+	p.order = append(p.order, o)
 
 	if o.short != "" {
-		shortKeys[o.short] = o
+		p.shortKeys[o.short] = o
 	}
 
 	if o.long != "" {
-		longKeys[o.long] = o
+		p.longKeys[o.long] = o
 	}
 
 	if o.required {
-		requiredOpts[o.key] = true
+		p.requiredOpts[o.key] = true
 	}
 
 	return nil
@@ -188,167 +743,309 @@ func RegisterOpt(key, long, short string, isBool, isReq bool, usage string) erro
 // Remove any registered options.  This is primarly to ease testing but could potentially be
 // handy depending on execution context of a program?  This will also clear the list of "extra"
 // arguments - to use any args at all from getopt, you'll need to re-run parse after running this.
-func ClearAll() {
-	for key, _ := range opts {
-		Clear(key)
+func (p *Parser) ClearAll() {
+	for key, _ := range p.opts {
+		p.Clear(key)
 	}
 
-	// Since we're clearing everything, wipe out the extra args too
-	extraArgs = make([]string, 0)
-	// Also any existing parse errors
-	parseError = ""
-
+	// Since we're clearing everything, wipe out the commands, extra args and any existing parse
+	// errors too, along with any config file values which were for the options
+	p.commands = make(map[string]*Parser)
+	p.commandOrder = make([]*Parser, 0)
+	p.resetResults()
+	p.configVals = make(map[string]*configVal)
+	p.parsed = false
+	p.group = ""
 }
 
 // Remove a single option by key.  This will also remove it's bool/string val if parse has
 // already been run
-func Clear(key string) {
-	opt, ok := opts[key]
+func (p *Parser) Clear(key string) {
+	opt, ok := p.opts[key]
 	if ok {
 
 		if opt.short != "" {
-			delete(shortKeys, opt.short)
+			delete(p.shortKeys, opt.short)
 		}
 
 		if opt.long != "" {
-			delete(longKeys, opt.long)
+			delete(p.longKeys, opt.long)
+		}
+
+		if opt.negation != nil {
+			delete(p.longKeys, opt.negation.long)
 		}
 
 		if opt.required {
-			delete(requiredOpts, opt.key)
+			delete(p.requiredOpts, opt.key)
 		}
 
-		// Delete any registered values for this option
-		if opt.isBool {
-			_, ok := boolVals[opt.key]
-			if ok {
-				delete(boolVals, opt.key)
-			}
-		} else {
-			_, ok := stringVals[opt.key]
-			if ok {
-				delete(stringVals, opt.key)
+		// Delete any registered values for this option.  Typed options keep their values in
+		// more than one place so just clear out every holder.
+		delete(p.boolVals, opt.key)
+		delete(p.counts, opt.key)
+		delete(p.stringVals, opt.key)
+		delete(p.multiVals, opt.key)
+		delete(p.typedVals, opt.key)
+		delete(p.sources, opt.key)
+
+		delete(p.opts, key)
+
+		for i, ordered := range p.order {
+			if ordered == opt {
+				p.order = append(p.order[:i], p.order[i+1:]...)
+				break
 			}
 		}
 
-		delete(opts, key)
+	}
+}
+
+// Set how options and non-option arguments can be mixed.  See the MODE_* constants.  This takes
+// effect the next time the parser runs.
+func (p *Parser) SetParseMode(mode ParseMode) {
+	p.mode = mode
+}
+
+// Allow long options to be abbreviated to any unambiguous prefix, the way GNU getopt_long() does (so
+// --verb works for --verbose).  An exact match always wins over a prefix match.  Off by default.
+func (p *Parser) SetAllowAbbrev(allow bool) {
+	p.allowAbbrev = allow
+}
+
+// Keep parsing after an error instead of stopping at the first one, so everything wrong with the
+// command line can be reported at once.  Unknown, ambiguous and repeated options, missing and bad
+// values are all collected, bad values from the environment and config files too, and the required
+// options are still checked at the end.  GetError() then
+// returns every error joined with errors.Join(), or just the one if there's only one, and errors.As()
+// and errors.Is() find any of them.  A missing command still stops parsing.  Off by default.  On a
+// command tree it's the setting of the parser at the top which counts.
+func (p *Parser) SetCollectErrors(collect bool) {
+	p.collectErrors = collect
+}
+
+// Get a string value for an option key.  If the option wasn't given this is its default value, or ""
+// if it doesn't have one.  Only makes sense if Parse() has been called.
+func (p *Parser) GetString(key string) string {
+	val, _ := p.Lookup(key)
+	return val
+}
+
+// Get a string value for an option key along with whether or not the option was actually given (on
+// the command line, in the environment or in a config file), so an option given as "" can be told
+// apart from one left off.  If it wasn't given the value is the option's default, or "" if it
+// doesn't have one.  Only makes sense if Parse() has been called.
+func (p *Parser) Lookup(key string) (string, bool) {
+	owner := p.ownerOf(key)
+	val, ok := owner.stringVals[key]
+	if ok {
+		return val, true
+	}
 
+	o, ok := owner.opts[key]
+	if ok && o.hasDefault {
+		return o.defVal, false
 	}
+	return "", false
 }
 
-// Get a string value for an option key.  Only makes sense if Parse() has been called.
-func GetString(key string) string {
-	val, ok := stringVals[key]
+// Get every value given for an option key, in the order given.  Unless the option's duplicate policy
+// is DUP_APPEND this will hold at most one value.  If the option wasn't given this holds just its
+// default value, or is empty if it doesn't have one.
+// Only makes sense if Parse() has been called.
+func (p *Parser) GetStrings(key string) []string {
+	owner := p.ownerOf(key)
+	vals, ok := owner.multiVals[key]
 	if ok {
-		return val
+		return vals
 	}
-	return ""
+
+	o, ok := owner.opts[key]
+	if ok && o.hasDefault {
+		return []string{o.defVal}
+	}
+	return []string{}
+}
+
+// Get the count for a counter option key.  This is 0 if the option wasn't given, or if it was given
+// as often as its decrementing options.  Only makes sense if Parse() has been called.
+func (p *Parser) GetCount(key string) int {
+	owner := p.ownerOf(key)
+	return owner.counts[key]
 }
 
 // Get a bool value for an option key.  Only makes sense if Parse() has been called.
-func GetBool(key string) bool {
-	_, ok := boolVals[key]
+func (p *Parser) GetBool(key string) bool {
+	val, _ := p.LookupBool(key)
+	return val
+}
+
+// Get a bool value for an option key along with whether or not the switch was given at all, so an
+// explicit --foo=false or --no-foo can be told apart from leaving the switch off.  Only makes sense
+// if Parse() has been called.
+func (p *Parser) LookupBool(key string) (bool, bool) {
+	owner := p.ownerOf(key)
+	val, ok := owner.boolVals[key]
 	if ok {
-		return true
+		return val, true
 	}
-	return false
+
+	// Only TYPE_BOOL options can have a default
+	def, _ := p.typedVal(key).(bool)
+	return def, false
 }
 
 // Get any "extra" non-option arguments passed to the program.  This excludes argv[1] - the program
 // name.  Only makes sense if Parse() has been called.
-func GetArgs() []string {
-	return extraArgs
+func (p *Parser) GetArgs() []string {
+	return p.extraArgs
+}
+
+// Get the position of the "--" terminator in the parsed arguments, or -1 if there wasn't one.  The
+// position is an index into the list given to ParseArgs(), which for Parse() is os.Args without the
+// program name (so os.Args[GetTerminatorIndex()+1] is the terminator itself).  When the terminator
+// comes after a command, the parsers above the command report it too.  Only makes sense if Parse()
+// has been called.
+func (p *Parser) GetTerminatorIndex() int {
+	return p.terminator
+}
+
+// Get the arguments which came after the "--" terminator, untouched.  These are also included at the
+// end of GetArgs() - the command's GetArgs() if the terminator came after a command, though they can
+// be had from any parser above it here.  Handy for passing everything after the terminator along to
+// another program.  Only makes sense if Parse() has been called.
+func (p *Parser) GetArgsAfterTerminator() []string {
+	if p.terminator < 0 {
+		return make([]string, 0)
+	}
+	return p.args[p.terminator+1:]
+}
+
+// Advance the option iterator, returning false once every option found by the last parse has been
+// handed back.  This allows a classic getopt() loop which sees options in order, repeats included:
+//
+//	for p.Next() {
+//		switch p.Opt().Key {
+//		...
+//		}
+//	}
+//
+// Only makes sense if Parse() has been called.
+func (p *Parser) Next() bool {
+	if p.cursor < len(p.occurrences) {
+		p.cursor++
+	}
+	return p.cursor < len(p.occurrences)
+}
+
+// Get the option the iterator is currently on.  Returns nil if Next() hasn't been called yet or has
+// already returned false.
+func (p *Parser) Opt() *Option {
+	if p.cursor >= 0 && p.cursor < len(p.occurrences) {
+		return p.occurrences[p.cursor]
+	}
+	return nil
 }
 
 // Check if there's a parse error.  Only makes sense if Parse() has been called.
-func HasError() bool {
-	if parseError == "" {
+func (p *Parser) HasError() bool {
+	if p.parseError == nil {
 		return false
 	}
 	return true
 }
 
-// Get the parse error if present.  Only makes sense if Parse() has been called.
-func GetError() error {
-	if HasError() {
-		return errors.New(parseError)
+// Get the parse error if present.  Only makes sense if Parse() has been called.  Errors found while
+// parsing are a *ParseError, which can be checked with errors.As() or errors.Is() (see ErrorKind).
+// When errors are being collected and there's more than one, they come joined with errors.Join().
+func (p *Parser) GetError() error {
+	if p.HasError() {
+		return p.parseError
 	}
 	return nil
 }
 
-// Get the usage for each option
-func GetUsage() string {
-	useStr := ""
-	for _, opt := range opts {
-		// <option> <arg> <usage>
-
-		if opt.short != "" {
-			useStr += "-" + opt.short + " "
-		}
-
-		if opt.long != "" {
-			useStr += "--" + opt.long + " "
-		}
-
-		if opt.required {
-			useStr += "REQUIRED "
-		}
+// Read the current command line args and compare them to the registered options.  The results are
+// stored on the parser and can be read back with GetBool(), GetString() and GetArgs().  This is the
+// same as calling ParseArgs() with os.Args minus the program name.
+func (p *Parser) Parse() {
+	if len(os.Args) < 1 {
+		p.ParseArgs([]string{})
+		return
+	}
+	p.ParseArgs(os.Args[1:])
+}
 
-		if !opt.isBool {
-			useStr += "<value> "
-		}
+// Parse an explicit list of arguments against the registered options.  The list must not contain
+// the program name (argv[0]), so this can be used on argument lists which come from somewhere other
+// than the command line.  Any results from a previous parse are discarded first.
+func (p *Parser) ParseArgs(args []string) {
+	p.resetResults()
+	p.parseFrom(args, 0)
+	if p.parseError != nil && !p.collecting() {
+		return
+	}
 
-		if opt.usage != "" {
-			useStr += opt.usage + "\n"
-		}
+	if err := p.getMissingReqOptsError(); err != nil {
+		p.addError(err)
 	}
-	return useStr
 }
 
-func Parse() {
-	args := os.Args
+// Do the actual parsing for ParseArgs(), starting at args[start].  Commands pick up from where their
+// parent left off, so everything works off the same list of args and the indexes all line up.  This
+// doesn't check for required options, since that has to wait for any commands to finish.
+func (p *Parser) parseFrom(args []string, start int) {
+	p.parsed = true
+	p.args = args
+
+	requireOrder := p.requiresOrder()
+
+	// Main loop, iterating through each argument passed in to program.  The program's name has
+	// already been left out of args so everything here is fair game.
+	for i := start; i < len(args); i++ {
 
-	foundReqs := make(map[string]bool)
+		arg := args[i]
 
-	// This isn't an error, it just doesn't need to parse any arguments.  Unless of course there are
-	// required arguments.  Then it's totally an error.
-	if len(args) < 2 {
-		if len(requiredOpts) > 0 {
-			parseError = getMissingReqOptsError(foundReqs, requiredOpts)
+		// When completing, the word being completed isn't parsed, just looked at
+		if p.completing != nil && p.completing.at == i {
+			p.completeWord(arg)
 			return
 		}
 
-		return
-	}
-
-	// Main loop, iterating through each argument passed in to program.  Start at index 1 instead
-	// of 0 because there's no sense in processing argv[1] (the program's name)
-	for i := 1; i < len(args); i++ {
+		if arg == "--" {
 
-		arg := args[i]
+			// A bare "--" ends option processing.  Everything after it is an extra argument, even
+			// if it looks like an option.
+			p.completeRest(i)
+			p.terminator = i
+			p.extraArgs = append(p.extraArgs, args[i+1:]...)
+			break
 
-		if singleDashEquals.MatchString(arg) || multiDashEquals.MatchString(arg) {
+		} else if isEqualsArg(arg) {
 
 			// This is the case for -f=bar or --foo=bar
 
-			key, val, err := getValForEqualsSignArg(arg)
+			opt, val, err := p.getValForEqualsSignArg(arg)
 			if err != nil {
-				parseError = err.Error()
-				return
-			}
-
-			// This should realistically never error out since getValForEqualsSignArg() should
-			// have covered that possibility already.  Do the if checks anyway to prevent a run
-			// time crash.  This may turn out to be a poor decision.
-			opt, ok := opts[key]
-			if ok {
-				if opt.required {
-					foundReqs[key] = true
+				if p.fail(err, i) {
+					return
 				}
+				continue
 			}
 
 			// All good
-			stringVals[key] = val
+			if opt.isBool {
+				boolVal, _ := parseBoolVal(val)
+				if err := p.setBoolVal(opt, boolVal, true, i); err != nil {
+					if p.fail(err, i) {
+						return
+					}
+				}
+			} else if err := p.setString(opt, val, i); err != nil {
+				if p.fail(err, i) {
+					return
+				}
+			}
 
 		} else if multiDash.MatchString(arg) {
 			// This is a --longopt formed option.  It can either be a boolean option or it can
@@ -358,16 +1055,44 @@ func Parse() {
 			// TODO: is it a valid gnu-ism to do --fooVAL like with shortopts?
 
 			stripped := stripDashes(arg)
-			opt, ok := longKeys[stripped]
+			opt, err := p.lookupLong(stripped)
+			if err != nil {
+				if p.fail(err, i) {
+					return
+				}
+				continue
+			}
 
-			if !ok {
-				parseError = ERR_NO_OPT + arg
-				return
+			if opt == nil {
+				if p.fail(newParseError(KIND_NO_OPT, nil, ERR_NO_OPT+arg), i) {
+					return
+				}
+				continue
 			}
 
-			if opt.isBool {
+			if opt.negates != nil {
+				// --no-foo turns off the switch it was made for
+				if err := p.setBoolVal(opt.negates, false, true, i); err != nil {
+					if p.fail(err, i) {
+						return
+					}
+				}
+
+			} else if opt.isBool {
 				// If it's a boolean value, set it and stop here
-				boolVals[opt.key] = true
+				if err := p.setBool(opt, i); err != nil {
+					if p.fail(err, i) {
+						return
+					}
+				}
+
+			} else if opt.isOptional {
+				// The value is optional and wasn't attached, so never look ahead for it
+				if err := p.setString(opt, opt.implicitVal, i); err != nil {
+					if p.fail(err, i) {
+						return
+					}
+				}
 
 			} else {
 
@@ -375,20 +1100,26 @@ func Parse() {
 				// attempts to get the next value in the args list and use that as a value.  If
 				// that's a valid value (not another opt) set that value, otherwise it's an error.
 
-				val := lookaheadForVal(args, i)
-				if val == "" {
-					parseError = ERR_MISSING_VAL + arg
+				if p.completeVal(opt, i) {
 					return
 				}
 
-				if opt.required {
-					foundReqs[opt.key] = true
+				val := lookaheadForVal(args, i)
+				if val == "" {
+					if p.fail(newParseError(KIND_MISSING_VAL, opt, ERR_MISSING_VAL+arg), i) {
+						return
+					}
+					continue
 				}
 
 				// All good - since a lookahead was done the loop counter MUST be incremented here
-				// so an argument doesn't get double-processed
+				// so an argument doesn't get double-processed, even if the value was bad
+				if err := p.setString(opt, val, i); err != nil {
+					if p.fail(err, i) {
+						return
+					}
+				}
 				i++
-				stringVals[opt.key] = val
 			}
 
 		} else if singleDash.MatchString(arg) {
@@ -398,105 +1129,129 @@ func Parse() {
 			//
 			// "-l" boolean switch
 			// "-l val" value after the switch (needs lookahead)
-			// "-lmx" multiopt (must all be boolean to be valid)
+			// "-lmx" multiopt, all boolean
 			// "-lVAL" value immediately after the switch, no lookahead
+			// "-lmxVAL" / "-lmx VAL" multiopt where the last switch takes a value
+			//
+			// All of these are a group of combined shortopts as far as splitShortCluster() is
+			// concerned - a single switch is just a very small group.
 
-			// First strip the dashes
-			stripped := stripDashes(arg)
+			clustered, val, hasVal, err := p.splitShortCluster(arg)
+			if err != nil {
+				if p.fail(err, i) {
+					return
+				}
+				continue
+			}
 
-			// Check length - if the len is 1, it's got to be a boolean switch or needs
-			// lookahead to find the value
-			if len(stripped) == 1 {
-				opt, ok := shortKeys[stripped]
-				if ok {
-
-					if opt.isBool {
-						boolVals[opt.key] = true
-					} else {
-						val := lookaheadForVal(args, i)
-						if val == "" {
-							parseError = ERR_MISSING_VAL + arg
+			for _, opt := range clustered {
+				if opt.isBool {
+					if err := p.setBool(opt, i); err != nil {
+						if p.fail(err, i) {
 							return
 						}
+					}
 
-						if opt.required {
-							foundReqs[opt.key] = true
+				} else if hasVal {
+					// Everything after the switch in the group is its value
+					if err := p.setString(opt, val, i); err != nil {
+						if p.fail(err, i) {
+							return
 						}
+					}
 
-						i++
-						stringVals[opt.key] = val
+				} else if opt.isOptional {
+					if err := p.setString(opt, opt.implicitVal, i); err != nil {
+						if p.fail(err, i) {
+							return
+						}
 					}
 
 				} else {
-					parseError = ERR_NO_OPT + arg
-					return
-				}
-			} else {
-				// Longer than 1 - this means either a multiopt or -lVAL format.
-				// First check for multiopt
-				multiOpts := getMultiOptKeys(arg)
-				if multiOpts != nil {
-
-					for _, k := range multiOpts {
+					// The group ended with the switch, so the value has to be the next argument
+					if p.completeVal(opt, i) {
+						return
+					}
 
-						// Already did check for map presence in getMultiOptKeys()
-						opt := shortKeys[k]
-						if !opt.isBool {
-							parseError = ERR_NONBOOL_MULTI + k
+					val := lookaheadForVal(args, i)
+					if val == "" {
+						if p.fail(newParseError(KIND_MISSING_VAL, opt, ERR_MISSING_VAL+arg), i) {
 							return
 						}
+						break // Only the last switch in a group can be missing a value
 					}
 
-					// Second iteration of the same slice.  If the code is here it means everything
-					// was correct.
-					for _, k := range multiOpts {
-						// All good, so set these
-						boolVals[shortKeys[k].key] = true
+					if err := p.setString(opt, val, i); err != nil {
+						if p.fail(err, i) {
+							return
+						}
 					}
+					i++
+				}
+			}
 
-				} else {
-					// Not multiopt, so the last possibility is that the characters immediately following
-					// the option are the string value.
-
-					// Get the first char, make sure it's an actual option
-					key := string(stripped[0])
-					opt, ok := shortKeys[key]
-					if !ok {
-						parseError = ERR_NO_OPT + key
-						return
-					}
+		} else {
 
-					// Make sure this isn't a boolean
-					if opt.isBool {
-						parseError = ERR_BOOL_WITH_VAL + arg
+			// Finally, this is just a "default" argument, no part of any option.  If the parser
+			// has commands, the first one of these is the command name and the command gets
+			// the rest of the args.
+			if len(p.commands) > 0 {
+				cmd, ok := p.commands[arg]
+				if !ok {
+					if p.fail(newParseError(KIND_NO_CMD, nil, ERR_NO_CMD+arg), i) {
 						return
 					}
+				}
 
-					// OK, all of the stuff that isn't the key in the string is the value
-					// This counts as all good
+				p.command = cmd
+				cmd.completing = p.completing
+				cmd.parseFrom(args, i+1)
 
-					if opt.required {
-						foundReqs[opt.key] = true
+				// The terminator is in the same args, so it's reported from up here as well
+				p.terminator = cmd.terminator
+				if cmd.parseError != nil {
+					for _, err := range cmd.parseErrors {
+						p.addError(err)
 					}
 
-					val := string(stripped[1:])
-					stringVals[opt.key] = val
+					if !p.collecting() {
+						return
+					}
 				}
+				break
 			}
 
-		} else {
+			// Otherwise it goes into its own slice of values, in the order provided to the
+			// script.  When options have to come first, this one and everything after it are
+			// non-options.
+			if requireOrder {
+				p.completeRest(i)
+				p.extraArgs = append(p.extraArgs, args[i:]...)
+				break
+			}
+			p.extraArgs = append(p.extraArgs, arg)
 
-			// Finally, this is just a "default" argument, no part of any option.  It goes into
-			// its own slice of values, in the order provided to the script.
-			extraArgs = append(extraArgs, arg)
+			// In return-in-order mode the iterator hands these back inline with the options
+			if p.mode == MODE_RETURN_IN_ORDER {
+				p.occurrences = append(p.occurrences, &Option{Key: "", Value: arg, Index: i})
+			}
 		}
 	}
 
-	if len(requiredOpts) > 0 {
-		parseError = getMissingReqOptsError(foundReqs, requiredOpts)
-		if parseError != "" {
-			return
-		}
+	// Anything not given on the command line can still come from the environment.  This has to
+	// happen before the required check so those values count.
+	errs := p.applyEnv()
+	for _, err := range errs {
+		p.addError(err)
+	}
+
+	if len(errs) > 0 && !p.collecting() {
+		return
+	}
+
+	// Then config files, for anything still left
+	for _, err := range p.applyConfig() {
+		p.addError(err)
 	}
 }
 
@@ -504,20 +1259,160 @@ func Parse() {
 //  Helper functions to make the parser more readable
 //
 
+// Work out whether the parser should stop at the first non-option argument, based on its mode and
+// (possibly) the environment.
+func (p *Parser) requiresOrder() bool {
+	switch p.mode {
+	case MODE_REQUIRE_ORDER:
+		return true
+	case MODE_POSIXLY_CORRECT:
+		_, set := os.LookupEnv("POSIXLY_CORRECT")
+		return set
+	}
+	return false
+}
+
+// Record a boolean switch found at args[index].  For this and the other setters, an index of -1 means
+// the value came from somewhere other than the command line, so the iterator doesn't see it.
+func (p *Parser) setBool(o *opt, index int) error {
+	return p.setBoolVal(o, true, false, index)
+}
+
+// Record a boolean value for a switch found at args[index].  If the value was given explicitly
+// (--foo=false, --no-foo) it's passed along to the iterator, otherwise the iterator gets "".
+func (p *Parser) setBoolVal(o *opt, val bool, explicit bool, index int) error {
+	owner := o.owner
+	_, seen := owner.boolVals[o.key]
+	if seen && o.dupPolicy == DUP_ERROR {
+		return newParseError(KIND_DUPLICATE_OPT, o, ERR_DUPLICATE_OPT+optDisplayName(o))
+	}
+
+	iterVal := ""
+	if explicit {
+		iterVal = strconv.FormatBool(val)
+	}
+
+	if seen && o.dupPolicy == DUP_FIRST_WINS {
+		// Same as for values, the iterator still sees it but the switch keeps its first setting
+		if index >= 0 {
+			p.occurrences = append(p.occurrences, &Option{Key: o.key, Value: iterVal, Index: index})
+		}
+		return nil
+	}
+
+	if o.isCounter {
+		owner.counts[o.counterKey] += o.step
+	}
+
+	owner.boolVals[o.key] = val
+	if index >= 0 {
+		p.occurrences = append(p.occurrences, &Option{Key: o.key, Value: iterVal, Index: index})
+		p.setCommandLineSource(o, index)
+	}
+	return nil
+}
+
+// Record a string value for an option found at args[index], following the option's duplicate
+// policy if it was already given.  Typed options have the value converted here as well.  Values
+// are kept by the parser which owns the option, which for a persistent option used by a command
+// is one of the command's parents.
+func (p *Parser) setString(o *opt, val string, index int) error {
+	converted, err := convertVal(o, val)
+	if err != nil {
+		return err
+	}
+
+	owner := o.owner
+	_, seen := owner.stringVals[o.key]
+
+	if seen && o.dupPolicy == DUP_ERROR {
+		return newParseError(KIND_DUPLICATE_OPT, o, ERR_DUPLICATE_OPT+optDisplayName(o))
+	}
+
+	if seen && o.dupPolicy == DUP_FIRST_WINS {
+		// Still an occurrence as far as the iterator is concerned, it just doesn't change the value
+		if index >= 0 {
+			p.occurrences = append(p.occurrences, &Option{Key: o.key, Value: val, Index: index})
+		}
+		return nil
+	}
+
+	// Options backed by a Value get every value handed to them, and can turn it down
+	if o.value != nil {
+		err = o.value.Set(val)
+		if err != nil {
+			e := newParseError(KIND_INVALID_VAL, o, ERR_INVALID_VAL+optDisplayName(o)+": "+err.Error())
+			e.Err = err
+			return e
+		}
+	}
+
+	if seen && o.dupPolicy == DUP_APPEND {
+		owner.multiVals[o.key] = append(owner.multiVals[o.key], val)
+	} else {
+		owner.multiVals[o.key] = []string{val}
+	}
+
+	if o.required {
+		owner.foundReqs[o.key] = true
+	}
+
+	owner.stringVals[o.key] = val
+	if o.valType != TYPE_STRING {
+		owner.typedVals[o.key] = converted
+	}
+
+	// Typed bools count as switches too, so GetBool() works on them
+	if o.valType == TYPE_BOOL {
+		owner.boolVals[o.key] = converted.(bool)
+	}
+
+	if index >= 0 {
+		p.occurrences = append(p.occurrences, &Option{Key: o.key, Value: val, Index: index})
+		p.setCommandLineSource(o, index)
+	}
+	return nil
+}
+
+// Throw away the values, extra args and error from any previous parse so a parser can be run
+// more than once.
+func (p *Parser) resetResults() {
+	p.boolVals = make(map[string]bool)
+	p.stringVals = make(map[string]string)
+	p.multiVals = make(map[string][]string)
+	p.typedVals = make(map[string]interface{})
+	p.counts = make(map[string]int)
+	p.sources = make(map[string]Source)
+	p.args = make([]string, 0)
+	p.extraArgs = make([]string, 0)
+	p.foundReqs = make(map[string]bool)
+	p.occurrences = make([]*Option, 0)
+	p.cursor = -1
+	p.command = nil
+	p.terminator = -1
+	p.parseError = nil
+	p.parseErrors = nil
+
+	// Whichever command gets chosen this time, nothing from last time should be left behind
+	for _, cmd := range p.commandOrder {
+		cmd.resetResults()
+	}
+}
+
 // When provided with an argument with an equals sign in it, this will
 // split the parts up and do checking on the option to make sure it
 // both exists and isn't boolean
-func getValForEqualsSignArg(arg string) (key, val string, err error) {
+func (p *Parser) getValForEqualsSignArg(arg string) (o *opt, val string, err error) {
 
 	// Defaults for the return values
-	key = ""
+	o = nil
 	val = ""
 	err = nil
 
 	// Check to see if we can split the parts up properly
 	parts := splitEqualsArg(arg)
 	if parts == nil {
-		err = errors.New(ERR_MISSING_VAL + arg)
+		err = newParseError(KIND_MISSING_VAL, nil, ERR_MISSING_VAL+arg)
 		return
 	}
 
@@ -525,61 +1420,161 @@ func getValForEqualsSignArg(arg string) (key, val string, err error) {
 	var ok bool = false
 
 	if multiDash.MatchString(arg) {
-		opt, ok = longKeys[parts[0]]
-		if !ok {
-			err = errors.New(ERR_NO_OPT + parts[0])
+		opt, err = p.lookupLong(parts[0])
+		if err != nil {
+			return
+		}
+
+		if opt == nil {
+			err = newParseError(KIND_NO_OPT, nil, ERR_NO_OPT+parts[0])
 			return
 		}
 	} else if singleDash.MatchString(arg) {
-		opt, ok = shortKeys[parts[0]]
+		opt = p.findShort(parts[0])
+		ok = opt != nil
 		if !ok {
-			err = errors.New(ERR_NO_OPT + parts[0])
+			err = newParseError(KIND_NO_OPT, nil, ERR_NO_OPT+parts[0])
 			return
 		}
 	}
 
-	// Make sure this isn't a boolean option
+	// Make sure this isn't a boolean option, unless it's a plain switch being given an explicit
+	// true or false
 	if opt.isBool {
-		err = errors.New(ERR_BOOL_WITH_VAL + arg)
-		return
+		_, isBoolVal := parseBoolVal(parts[1])
+		if !isBoolVal || opt.isCounter || opt.negates != nil {
+			err = newParseError(KIND_BOOL_WITH_VAL, opt, ERR_BOOL_WITH_VAL+arg)
+			return
+		}
 	}
 
 	if len(parts[1]) < 1 {
-		err = errors.New(ERR_MISSING_VAL + arg)
+		err = newParseError(KIND_MISSING_VAL, opt, ERR_MISSING_VAL+arg)
 		return
 	}
 
 	// All good
-	key = opt.key
+	o = opt
 	val = parts[1]
 	return
 }
 
-// When passed in something in the form of -xyx, it could have one of two
-// meanings:  -x -y -z or -x=yz.  This function checks to see if it's the latter
-// and if so returns each opt shortval as a string slice
-func getMultiOptKeys(arg string) []string {
+// Turn an explicit boolean value (true/false, yes/no, 1/0, any case) into a bool.  The second return
+// value is false if the string isn't one of those.
+func parseBoolVal(val string) (bool, bool) {
+	switch strings.ToLower(val) {
+	case "true", "yes", "1":
+		return true, true
+	case "false", "no", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// Find the option for a long key (without the dashes).  An exact match always wins.  If abbreviations
+// are allowed and there's no exact match, a prefix of exactly one registered long key matches that
+// option, while a prefix of several is an error listing them.  Returns a nil option and error if
+// nothing matches at all.
+func (p *Parser) lookupLong(name string) (*opt, error) {
+	longKeys := p.visibleLongKeys()
+
+	o, ok := longKeys[name]
+	if ok {
+		return o, nil
+	}
+
+	if !p.allowAbbrev {
+		return nil, nil
+	}
+
+	candidates := make([]string, 0)
+	for long, _ := range longKeys {
+		if strings.HasPrefix(long, name) {
+			candidates = append(candidates, long)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return longKeys[candidates[0]], nil
+	}
+
+	if len(candidates) > 1 {
+		sort.Strings(candidates)
+		return nil, newParseError(KIND_AMBIGUOUS_OPT, nil, ERR_AMBIGUOUS_OPT+"--"+name+" (could be --"+strings.Join(candidates, ", --")+")")
+	}
+
+	return nil, nil
+}
+
+// When passed in something in the form of -xyz, it could mean -x -y -z or, if one of them takes a value,
+// something like -x -y -z=VAL.  Following POSIX, every switch in the group up to the first one which takes
+// a value is a boolean, and everything after that first value-taking switch is its value.  This returns
+// the options in the group in order, with only the last one able to take a value.  If the group kept
+// going after the value-taking switch, val holds the rest of it (minus an "=" right after the switch)
+// and hasVal is true.
+func (p *Parser) splitShortCluster(arg string) (clustered []*opt, val string, hasVal bool, err error) {
+
+	// Defaults for the return values
+	clustered = make([]*opt, 0)
+	val = ""
+	hasVal = false
+	err = nil
 
-	// strip the "-" from the front of the arg (in case)
 	workingArg := stripDashes(arg)
-	parts := strings.Split(workingArg, "")
-	multiOptParts := make([]string, 0)
-	isMultiOpt := true
-	for _, part := range parts {
-		_, ok := shortKeys[part]
-		if !ok {
-			isMultiOpt = false
-			break
-		} else {
-			multiOptParts = append(multiOptParts, part)
+
+	for j := 0; j < len(workingArg); j++ {
+		key := string(workingArg[j])
+		opt := p.findShort(key)
+		if opt == nil {
+			err = newParseError(KIND_NO_OPT, nil, ERR_NO_OPT+"-"+key)
+			return
+		}
+
+		clustered = append(clustered, opt)
+		rest := workingArg[j+1:]
+
+		if opt.isBool {
+
+			// Booleans can't be given a value with an equals sign, even at the end of a group
+			if strings.HasPrefix(rest, "=") {
+				err = newParseError(KIND_BOOL_WITH_VAL, opt, ERR_BOOL_WITH_VAL+arg)
+				return
+			}
+			continue
+		}
+
+		// First one which takes a value, so it gets whatever is left (if anything)
+		if strings.HasPrefix(rest, "=") {
+			rest = rest[1:]
+			if rest == "" {
+				err = newParseError(KIND_MISSING_VAL, opt, ERR_MISSING_VAL+arg)
+				return
+			}
+		}
+
+		if rest != "" {
+			val = rest
+			hasVal = true
 		}
+		return
 	}
 
-	if isMultiOpt {
-		return multiOptParts
+	return
+}
+
+// Check if an argument is the -f=bar or --foo=bar form.  For shortopts, the equals sign has to come
+// right after the switch - anything else is a group of combined shortopts, like -xvf=bar.
+func isEqualsArg(arg string) bool {
+	if multiDashEquals.MatchString(arg) {
+		return true
 	}
 
-	return nil
+	if singleDashEquals.MatchString(arg) {
+		stripped := stripDashes(arg)
+		return len(stripped) > 1 && stripped[1] == '='
+	}
+
+	return false
 }
 
 // When passed a -f=bar or --foo=bar type argument where the value
@@ -628,47 +1623,47 @@ func lookaheadForVal(args []string, currentKey int) string {
 	return ""
 }
 
-// Check to see if any required options are missing and generate/return an error message if so.
-func getMissingReqOptsError(foundReqOpts map[string]bool, requiredOpts map[string]bool) string {
-
-	missingKeys := make([]string, 0)
+// Get the name of an option the way it would be given on the command line, for error messages.  If it
+// has both a short and long form both are given.
+func optDisplayName(o *opt) string {
+	if o.short != "" && o.long != "" {
+		return "-" + o.short + " or " + "--" + o.long
+	}
 
-	for reqName, _ := range requiredOpts {
-		_, found := foundReqOpts[reqName]
-		if !found {
-			missingKeys = append(missingKeys, reqName)
-		}
+	if o.long != "" {
+		return "--" + o.long
 	}
 
-	if len(missingKeys) > 0 {
-		errorText := ERR_REQ
-		for i, mk := range missingKeys {
-			opt, ok := opts[mk]
-			msgKey := mk
-			if ok {
-
-				if opt.short != "" {
-					msgKey = "-" + opt.short
-				}
+	return "-" + o.short
+}
 
-				if opt.long != "" {
-					msgKey = "--" + opt.long
-				}
+// Check to see if any required options are missing, from this parser or any command chosen under it,
+// and generate/return an error if so.  Options which belong to a command say so.
+func (p *Parser) getMissingReqOptsError() error {
 
-				if opt.short != "" && opt.long != "" {
-					msgKey = "-" + opt.short + " or " + "--" + opt.long
+	missingKeys := make([]string, 0)
+	missing := make([]string, 0)
+
+	for q := p; q != nil; q = q.command {
+		for _, o := range q.order {
+			_, found := q.foundReqs[o.key]
+			if q.requiredOpts[o.key] && !found {
+				msgKey := optDisplayName(o)
+				if q.parent != nil {
+					msgKey += " (for command: " + q.GetCommandPath() + ")"
 				}
+				missingKeys = append(missingKeys, msgKey)
+				missing = append(missing, o.key)
 			}
-
-			if i < len(missingKeys)-1 {
-				errorText += msgKey + ", "
-			} else {
-				errorText += msgKey
-			}
-
 		}
-		return errorText
 	}
 
-	return ""
+	if len(missingKeys) > 0 {
+		e := newParseError(KIND_REQ, nil, ERR_REQ+strings.Join(missingKeys, ", "))
+		e.Key = missing[0]
+		e.Missing = missing
+		return e
+	}
+
+	return nil
 }
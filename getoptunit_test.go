@@ -153,3 +153,67 @@ func TestSplitEqualsArg(t *testing.T) {
 		t.Error("splitEqualsArg() didn't return nil for argument without equals sign: " + NOEQUALS)
 	}
 }
+
+// Test the splitShortCluster() function.  This one needs some options registered, so it gets its own
+// parser rather than touching the package-wide one.
+func TestSplitShortCluster(t *testing.T) {
+	p := NewParser()
+	p.RegisterOpt("extract", "", "x", true, false, "test usage")
+	p.RegisterOpt("verbose", "", "v", true, false, "test usage")
+	p.RegisterOpt("file", "", "f", false, false, "test usage")
+	p.RegisterOptionalOpt("level", "", "O", "1", false, "test usage")
+
+	type clusterCase struct {
+		arg    string
+		keys   string
+		val    string
+		hasVal bool
+		isErr  bool
+	}
+
+	cases := []clusterCase{
+		{"-xv", "xv", "", false, false},                 // all booleans
+		{"-vvv", "vvv", "", false, false},               // same boolean repeated
+		{"-xvf", "xvf", "", false, false},               // ends with a value switch, value is the next arg
+		{"-xvfarchive", "xvf", "archive", true, false},  // value attached to the group
+		{"-xvf=archive", "xvf", "archive", true, false}, // value attached with an equals sign
+		{"-fxv", "f", "xv", true, false},                // value switch first takes the rest, even registered shorts
+		{"-f", "f", "", false, false},                   // a lone value switch
+		{"-fVAL", "f", "VAL", true, false},              // the old -lVAL form
+		{"-xO", "xO", "", false, false},                 // optional value switch with nothing attached
+		{"-xO3", "xO", "3", true, false},                // optional value switch with a value attached
+		{"-xq", "", "", false, true},                    // unregistered switch in the group
+		{"-xv=1", "", "", false, true},                  // booleans can't take values
+		{"-xf=", "", "", false, true},                   // equals sign with nothing after it
+	}
+
+	for _, c := range cases {
+		clustered, val, hasVal, err := p.splitShortCluster(c.arg)
+
+		if c.isErr {
+			if err == nil {
+				t.Error("splitShortCluster() didn't return an error for: " + c.arg)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Error("splitShortCluster() returned an error for: " + c.arg + ".  Got: " + err.Error())
+			continue
+		}
+
+		keys := ""
+		for _, o := range clustered {
+			keys += o.short
+		}
+
+		if keys != c.keys {
+			t.Error("splitShortCluster() returned the wrong options for: " + c.arg + ".  Expecting: " + c.keys + ".  Got: " + keys)
+		}
+
+		if val != c.val || hasVal != c.hasVal {
+			t.Errorf("splitShortCluster() returned the wrong value for: %s.  Expecting: %q (%v).  Got: %q (%v)",
+				c.arg, c.val, c.hasVal, val, hasVal)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gogetopt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Get a man page for the parser, in the roff format described by man(7), for the given manual section
+// (1 for user commands, 8 for system administration).  It has NAME, SYNOPSIS, DESCRIPTION, OPTIONS,
+// COMMANDS and ENVIRONMENT sections built from the same things as GetUsage(), with sections left out
+// when there's nothing to put in them.  The first line of the description set with SetDescription()
+// goes in NAME, and the rest in DESCRIPTION.  Hidden options aren't included.
+//
+// The page doesn't depend on anything but the registered options, so it can be written out by a
+// go generate step or a hidden --generate-man option and always match the program.
+func (p *Parser) GetManPage(section int) string {
+	prog := p.usageName()
+	name := strings.Replace(prog, " ", "-", -1)
+
+	description := p.description
+	if description == "" {
+		description = p.cmdUsage
+	}
+
+	summary := description
+	rest := ""
+	nl := strings.Index(description, "\n")
+	if nl >= 0 {
+		summary = description[:nl]
+		rest = strings.TrimSpace(description[nl+1:])
+	}
+
+	man := ".TH " + roffEscape(strings.ToUpper(name)) + " " + strconv.Itoa(section) + "\n"
+
+	man += ".SH NAME\n" + roffEscape(name)
+	if summary != "" {
+		man += " \\- " + roffEscape(summary)
+	}
+	man += "\n"
+
+	man += ".SH SYNOPSIS\n.B " + roffEscape(prog) + "\n"
+	args := strings.TrimSpace(strings.TrimPrefix(p.synopsis(), prog))
+	if args != "" {
+		man += roffText(args)
+	}
+
+	if rest != "" {
+		man += ".SH DESCRIPTION\n" + roffText(rest)
+	}
+
+	own, inherited := p.shownOpts()
+	if len(own) > 0 || len(inherited) > 0 {
+		man += ".SH OPTIONS\n" + manOpts(own)
+		if len(inherited) > 0 {
+			man += ".SS Global options\n" + manOpts(inherited)
+		}
+	}
+
+	commands := p.manCommands()
+	if commands != "" {
+		man += ".SH COMMANDS\n" + commands
+	}
+
+	env := p.manEnv()
+	if env != "" {
+		man += ".SH ENVIRONMENT\n" + env
+	}
+	return man
+}
+
+// Get the man page for the default parser.  See Parser.GetManPage().
+func GetManPage(section int) string {
+	return defaultParser.GetManPage(section)
+}
+
+//
+// Helpers
+//
+
+// List options as tagged paragraphs.  When some are in groups, each group gets a subsection.
+func manOpts(opts []*opt) string {
+	man := ""
+	titles, groups := groupOpts(opts)
+	for _, title := range titles {
+		if len(groups[title]) == 0 {
+			continue
+		}
+
+		if len(titles) > 1 {
+			man += ".SS " + roffEscape(title) + "\n"
+		}
+
+		for _, o := range groups[title] {
+			man += ".TP\n" + manOptTerm(o) + "\n" + roffText(optDescription(o))
+		}
+	}
+	return man
+}
+
+// Get the tag for an option's paragraph: its keys in bold and its value in italics
+func manOptTerm(o *opt) string {
+	term := ""
+	if o.short != "" {
+		term = "\\fB\\-" + roffEscape(o.short) + "\\fR"
+		if o.long != "" {
+			term += ", "
+		}
+	}
+
+	if o.negation != nil {
+		term += "\\fB\\-\\-\\fR[\\fBno\\-\\fR]\\fB" + roffEscape(o.long) + "\\fR"
+	} else if o.long != "" {
+		term += "\\fB\\-\\-" + roffEscape(o.long) + "\\fR"
+	}
+
+	if o.isOptional {
+		term += "[=\\fI" + roffEscape(valuePlaceholder(o)) + "\\fR]"
+	} else if !o.isBool {
+		term += " \\fI" + roffEscape(valuePlaceholder(o)) + "\\fR"
+	}
+	return term
+}
+
+// List every command under the parser, depth first, with the options of its own indented under it
+func (p *Parser) manCommands() string {
+	man := ""
+	for _, cmd := range p.commandOrder {
+		man += ".TP\n\\fB" + roffEscape(cmd.GetCommandPath()) + "\\fR\n"
+		if cmd.cmdUsage != "" {
+			man += roffText(cmd.cmdUsage)
+		}
+
+		own, _ := cmd.shownOpts()
+		if len(own) > 0 {
+			man += ".RS\n" + manOpts(own) + ".RE\n"
+		}
+		man += cmd.manCommands()
+	}
+	return man
+}
+
+// List the environment variables of the parser's options and those of every command under it
+func (p *Parser) manEnv() string {
+	man := ""
+	for _, o := range p.order {
+		if o.hidden {
+			continue
+		}
+
+		for _, name := range o.envVars {
+			man += ".TP\n.B " + roffEscape(name) + "\n"
+			man += roffText("Used for " + optDisplayName(o) + " when it isn't on the command line.")
+		}
+	}
+
+	for _, cmd := range p.commandOrder {
+		man += cmd.manEnv()
+	}
+	return man
+}
+
+// Escape text so roff prints it as it is: backslashes, and dashes so they aren't turned into hyphens
+func roffEscape(text string) string {
+	text = strings.Replace(text, "\\", "\\e", -1)
+	return strings.Replace(text, "-", "\\-", -1)
+}
+
+// Escape a block of text and lay it out as roff lines.  Blank lines start new paragraphs, and lines
+// which would be taken for requests are protected.
+func roffText(text string) string {
+	man := ""
+	if text == "" {
+		return man
+	}
+
+	for _, line := range strings.Split(roffEscape(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			man += ".PP\n"
+			continue
+		}
+
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = "\\&" + line
+		}
+		man += line + "\n"
+	}
+	return man
+}
@@ -0,0 +1,111 @@
+package gogetopt
+
+import (
+	"strings"
+	"testing"
+)
+
+// The man page is built from the registered options and commands
+func TestManPage(t *testing.T) {
+	p := NewParser()
+	p.SetProgName("prog")
+	p.SetDescription("copy files somewhere else\nCopies files.\n\n.Lines starting with a dot are kept as text.")
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "Say more")
+	regErr = p.RegisterOpt("output", "output", "o", false, true, "Write to `FILE`")
+	regErr = p.RegisterOptionalOpt("color", "color", "", "always", false, "When to use color")
+	regErr = p.RegisterOpt("man", "generate-man", "", true, false, "Print the man page")
+
+	if regErr != nil {
+		t.Error("GetManPage() test: Got reg error: " + regErr.Error())
+	}
+
+	p.SetEnv("output", "PROG_OUTPUT")
+	p.SetNegatable("verbose")
+	p.SetPersistent("verbose")
+
+	if p.SetHidden("man") != nil {
+		t.Error("SetHidden() failed for a registered key")
+	}
+
+	if p.SetHidden("nope") == nil {
+		t.Error("SetHidden() didn't fail for an unregistered key")
+	}
+
+	deploy, _ := p.AddCommand("deploy", "Deploy the app", nil)
+	deploy.RegisterOpt("env", "env", "e", false, false, "Where to")
+
+	expected := `.TH PROG 1
+.SH NAME
+prog \- copy files somewhere else
+.SH SYNOPSIS
+.B prog
+[OPTIONS] COMMAND [ARGS...]
+.SH DESCRIPTION
+Copies files.
+.PP
+\&.Lines starting with a dot are kept as text.
+.SH OPTIONS
+.TP
+\fB\-v\fR, \fB\-\-\fR[\fBno\-\fR]\fBverbose\fR
+Say more
+.TP
+\fB\-o\fR, \fB\-\-output\fR \fIFILE\fR
+Write to FILE (required) (env: PROG_OUTPUT)
+.TP
+\fB\-\-color\fR[=\fI<value>\fR]
+When to use color
+.SH COMMANDS
+.TP
+\fBdeploy\fR
+Deploy the app
+.RS
+.TP
+\fB\-e\fR, \fB\-\-env\fR \fI<value>\fR
+Where to
+.RE
+.SH ENVIRONMENT
+.TP
+.B PROG_OUTPUT
+Used for \-o or \-\-output when it isn't on the command line.
+`
+
+	man := p.GetManPage(1)
+	if man != expected {
+		t.Error("GetManPage() test: Didn't get the expected man page.  Got:\n" + man)
+	}
+
+	// Hidden options are left out of the usage too, but still work
+	usage := p.GetUsage()
+	if strings.Contains(usage, "generate-man") {
+		t.Error("GetUsage() test: Hidden option was shown.  Got:\n" + usage)
+	}
+
+	p.ParseArgs([]string{"--generate-man", "-o", "out"})
+	if p.HasError() || !p.GetBool("man") {
+		t.Error("Parse() test: Hidden option didn't work")
+	}
+
+	// A command's page is named after its path and lists what it inherits
+	expected = `.TH PROG\-DEPLOY 8
+.SH NAME
+prog\-deploy \- Deploy the app
+.SH SYNOPSIS
+.B prog deploy
+[OPTIONS] [ARGS...]
+.SH OPTIONS
+.TP
+\fB\-e\fR, \fB\-\-env\fR \fI<value>\fR
+Where to
+.SS Global options
+.TP
+\fB\-v\fR, \fB\-\-\fR[\fBno\-\fR]\fBverbose\fR
+Say more
+`
+
+	man = deploy.GetManPage(8)
+	if man != expected {
+		t.Error("GetManPage() test: Didn't get the expected man page for a command.  Got:\n" + man)
+	}
+}
@@ -325,3 +325,554 @@ func TestReqMissing(t *testing.T) {
 		t.Error("Parse() test: Didn't get a parse error when missing required options.")
 	}
 }
+
+// Make sure separate parsers keep their own options and results
+func TestIndependentParsers(t *testing.T) {
+	p1 := NewParser()
+	p2 := NewParser()
+
+	if regErr := p1.RegisterOpt("test", "test", "t", true, false, "test usage"); regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	// Same key on a different parser is not a conflict
+	if regErr := p2.RegisterOpt("test", "test", "t", false, false, "test usage"); regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	os.Args = []string{"ignoreme", "-t", "val"}
+
+	p1.Parse()
+	if p1.HasError() {
+		t.Error("Parse() test: Got a parse error: " + p1.GetError().Error())
+	}
+
+	if !p1.GetBool("test") {
+		t.Error("Parse() test: Didn't get a positive boolean when expecting one")
+	}
+
+	if p2.GetString("test") != "" {
+		t.Error("Parse() test: Parsing one parser set a value on another")
+	}
+
+	p2.Parse()
+	if p2.HasError() {
+		t.Error("Parse() test: Got a parse error: " + p2.GetError().Error())
+	}
+
+	if p2.GetString("test") != "val" {
+		t.Error("Parse() test: Didn't get a string val.  Got: " + p2.GetString("test") + ".  Expected: val")
+	}
+}
+
+// Parse an explicit slice instead of os.Args, including the required option checks
+func TestParseArgs(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("test1", "", "a", false, true, "test usage")
+	regErr = RegisterOpt("test2", "wow", "", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	// Make sure os.Args isn't what gets parsed
+	os.Args = []string{"ignoreme", "--nope"}
+
+	ParseArgs([]string{"-a", "foo", "extra", "--wow"})
+	if HasError() {
+		t.Error("ParseArgs() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("test1") != "foo" {
+		t.Error("ParseArgs() test: Didn't get a string val.  Got: " + GetString("test1") + ".  Expected: foo")
+	}
+
+	if !GetBool("test2") {
+		t.Error("ParseArgs() test: Didn't get a positive boolean when expecting one")
+	}
+
+	if len(GetArgs()) != 1 || GetArgs()[0] != "extra" {
+		t.Errorf("ParseArgs() test: Didn't get the right extra args, got: %+v\n", GetArgs())
+	}
+
+	// A second parse should start from scratch and catch the missing required option
+	ParseArgs([]string{"extra"})
+	if !HasError() {
+		t.Error("ParseArgs() test: Didn't get a parse error when missing required options.")
+	}
+
+	if GetBool("test2") || len(GetArgs()) != 1 {
+		t.Error("ParseArgs() test: Results from the previous parse were kept")
+	}
+}
+
+// Everything after a bare "--" is an extra arg, even if it looks like an option
+func TestTerminator(t *testing.T) {
+	ClearAll()
+	regErr := RegisterOpt("test1", "", "v", true, false, "test usage")
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	ParseArgs([]string{"first", "-v", "--", "-file-starting-with-dash", "--v"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if !GetBool("test1") {
+		t.Error("Parse() test: Didn't get a positive boolean when expecting one")
+	}
+
+	args := GetArgs()
+	if len(args) != 3 || args[0] != "first" || args[1] != "-file-starting-with-dash" || args[2] != "--v" {
+		t.Errorf("Parse() test: Didn't get the right extra args, got: %+v\n", args)
+	}
+
+	if GetTerminatorIndex() != 2 {
+		t.Errorf("Parse() test: Wrong terminator index.  Got: %d.  Expected: 2", GetTerminatorIndex())
+	}
+
+	after := GetArgsAfterTerminator()
+	if len(after) != 2 || after[0] != "-file-starting-with-dash" {
+		t.Errorf("Parse() test: Didn't get the right args after the terminator, got: %+v\n", after)
+	}
+
+	// No terminator
+	ParseArgs([]string{"-v", "first"})
+	if GetTerminatorIndex() != -1 || len(GetArgsAfterTerminator()) != 0 {
+		t.Error("Parse() test: Found a terminator where there wasn't one")
+	}
+}
+
+// In require-order mode the first non-option ends option processing
+func TestRequireOrder(t *testing.T) {
+	ClearAll()
+	SetParseMode(MODE_REQUIRE_ORDER)
+	defer SetParseMode(MODE_PERMUTE)
+
+	var regErr error
+	regErr = RegisterOpt("test1", "", "v", true, false, "test usage")
+	regErr = RegisterOpt("test2", "", "x", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	ParseArgs([]string{"-v", "subprog", "-x", "--unknown"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if !GetBool("test1") || GetBool("test2") {
+		t.Error("Parse() test: Options after the first non-option were processed")
+	}
+
+	args := GetArgs()
+	if len(args) != 3 || args[0] != "subprog" || args[1] != "-x" || args[2] != "--unknown" {
+		t.Errorf("Parse() test: Didn't get the right extra args, got: %+v\n", args)
+	}
+
+	// POSIXLY_CORRECT mode should only require order when the variable is set
+	SetParseMode(MODE_POSIXLY_CORRECT)
+
+	os.Unsetenv("POSIXLY_CORRECT")
+	ParseArgs([]string{"subprog", "-x"})
+	if !GetBool("test2") {
+		t.Error("Parse() test: Option after a non-option wasn't processed without POSIXLY_CORRECT")
+	}
+
+	t.Setenv("POSIXLY_CORRECT", "1")
+	ParseArgs([]string{"subprog", "-x"})
+	if GetBool("test2") {
+		t.Error("Parse() test: Option after a non-option was processed with POSIXLY_CORRECT")
+	}
+}
+
+// The iterator should hand back every option in order, repeats included
+func TestIterator(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("include", "include", "I", false, false, "test usage")
+	regErr = RegisterOpt("verbose", "", "v", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	ParseArgs([]string{"-I", "dir1", "extra", "-v", "--include=dir2", "-Idir3"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if Opt() != nil {
+		t.Error("Iterator test: Opt() returned an option before Next() was called")
+	}
+
+	expected := []Option{
+		{Key: "include", Value: "dir1", Index: 0},
+		{Key: "verbose", Value: "", Index: 3},
+		{Key: "include", Value: "dir2", Index: 4},
+		{Key: "include", Value: "dir3", Index: 5},
+	}
+
+	found := 0
+	for Next() {
+		if found >= len(expected) {
+			t.Fatalf("Iterator test: Got more options than expected: %+v", *Opt())
+		}
+
+		if *Opt() != expected[found] {
+			t.Errorf("Iterator test: Got: %+v.  Expected: %+v", *Opt(), expected[found])
+		}
+		found++
+	}
+
+	if found != len(expected) {
+		t.Errorf("Iterator test: Got %d options.  Expected: %d", found, len(expected))
+	}
+
+	if Opt() != nil {
+		t.Error("Iterator test: Opt() returned an option after Next() returned false")
+	}
+
+	// Non-options come back inline in return-in-order mode
+	SetParseMode(MODE_RETURN_IN_ORDER)
+	defer SetParseMode(MODE_PERMUTE)
+
+	ParseArgs([]string{"first", "-v", "second"})
+	keys := ""
+	for Next() {
+		keys += Opt().Key + ":" + Opt().Value + " "
+	}
+
+	if keys != ":first verbose: :second " {
+		t.Error("Iterator test: Wrong order in return-in-order mode.  Got: " + keys)
+	}
+}
+
+// Unambiguous prefixes of long options are accepted when abbreviations are on
+func TestAbbreviations(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("verbose", "verbose", "", true, false, "test usage")
+	regErr = RegisterOpt("version", "version", "", true, false, "test usage")
+	regErr = RegisterOpt("output", "output", "", false, false, "test usage")
+	regErr = RegisterOpt("out", "out", "", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	// Off by default
+	ParseArgs([]string{"--verb"})
+	if !HasError() {
+		t.Error("Parse() test: Accepted an abbreviation without SetAllowAbbrev()")
+	}
+
+	SetAllowAbbrev(true)
+	defer SetAllowAbbrev(false)
+
+	// Exact match for --out wins over the --output prefix
+	ParseArgs([]string{"--verb", "--outp", "file1", "--out"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if !GetBool("verbose") || !GetBool("out") || GetString("output") != "file1" {
+		t.Error("Parse() test: Abbreviated options weren't matched to the right options")
+	}
+
+	ParseArgs([]string{"--outpu=file2"})
+	if GetString("output") != "file2" {
+		t.Error("Parse() test: Didn't get a string val for abbreviated equals expr.  Got: " + GetString("output"))
+	}
+
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_AMBIGUOUS_OPT+"--ver (could be --verbose, --version)") + "$")
+
+	ParseArgs([]string{"--ver"})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get an ambiguous option error, got: %v", GetError())
+	}
+
+	ParseArgs([]string{"--ver=x"})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get an ambiguous option error, got: %v", GetError())
+	}
+}
+
+// Options with an optional value take it only when attached
+func TestOptionalVals(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOptionalOpt("color", "color", "", "auto", false, "test usage")
+	regErr = RegisterOptionalOpt("level", "", "O", "1", true, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	// Bare forms get the implicit value and don't swallow the next arg
+	ParseArgs([]string{"--color", "always", "-O", "extra"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("color") != "auto" || GetString("level") != "1" {
+		t.Error("Parse() test: Bare optional value options didn't get their implicit values.  Got: " +
+			GetString("color") + ", " + GetString("level"))
+	}
+
+	if len(GetArgs()) != 2 || GetArgs()[0] != "always" {
+		t.Errorf("Parse() test: Didn't get the right extra args, got: %+v\n", GetArgs())
+	}
+
+	// Attached forms override it
+	ParseArgs([]string{"--color=never", "-O3"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("color") != "never" || GetString("level") != "3" {
+		t.Error("Parse() test: Attached optional values weren't used.  Got: " + GetString("color") + ", " + GetString("level"))
+	}
+
+	ParseArgs([]string{"-O=2"})
+	if GetString("level") != "2" {
+		t.Error("Parse() test: Attached optional value wasn't used.  Got: " + GetString("level"))
+	}
+
+	// Still required even though the value isn't
+	ParseArgs([]string{"--color"})
+	if !HasError() {
+		t.Error("Parse() test: Didn't get a parse error when missing required options.")
+	}
+}
+
+// Repeatable options keep every value, and the duplicate policies are followed
+func TestDuplicates(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterMultiOpt("include", "include", "I", false, "test usage")
+	regErr = RegisterOpt("last", "last", "", false, false, "test usage")
+	regErr = RegisterOpt("first", "first", "", false, false, "test usage")
+	regErr = RegisterOpt("once", "once", "", false, false, "test usage")
+	regErr = RegisterOpt("switch", "", "s", true, false, "test usage")
+	regErr = RegisterOpt("quiet", "quiet", "q", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	if err := SetDuplicatePolicy("first", DUP_FIRST_WINS); err != nil {
+		t.Error("SetDuplicatePolicy() failed: " + err.Error())
+	}
+
+	if err := SetDuplicatePolicy("once", DUP_ERROR); err != nil {
+		t.Error("SetDuplicatePolicy() failed: " + err.Error())
+	}
+
+	if err := SetDuplicatePolicy("switch", DUP_ERROR); err != nil {
+		t.Error("SetDuplicatePolicy() failed: " + err.Error())
+	}
+
+	if err := SetDuplicatePolicy("quiet", DUP_FIRST_WINS); err != nil {
+		t.Error("SetDuplicatePolicy() failed: " + err.Error())
+	}
+
+	if SetDuplicatePolicy("nope", DUP_ERROR) == nil {
+		t.Error("SetDuplicatePolicy() didn't fail for an unregistered key")
+	}
+
+	ParseArgs([]string{"-I", "dir1", "--include=dir2", "-Idir3", "--last", "a", "--last", "b",
+		"--first", "a", "--first", "b", "--once", "a"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	includes := GetStrings("include")
+	if len(includes) != 3 || includes[0] != "dir1" || includes[1] != "dir2" || includes[2] != "dir3" {
+		t.Errorf("Parse() test: Didn't get every value of a repeatable option, got: %+v", includes)
+	}
+
+	if GetString("include") != "dir3" {
+		t.Error("Parse() test: GetString() on a repeatable option didn't return the last value.  Got: " + GetString("include"))
+	}
+
+	if GetString("last") != "b" || len(GetStrings("last")) != 1 {
+		t.Error("Parse() test: Last value didn't win.  Got: " + GetString("last"))
+	}
+
+	if GetString("first") != "a" || len(GetStrings("first")) != 1 {
+		t.Error("Parse() test: First value didn't win.  Got: " + GetString("first"))
+	}
+
+	if len(GetStrings("nope")) != 0 {
+		t.Error("Parse() test: GetStrings() returned values for an option that wasn't given")
+	}
+
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_DUPLICATE_OPT) + ".+")
+
+	ParseArgs([]string{"--once", "a", "--once=b"})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get a duplicate option error, got: %v", GetError())
+	}
+
+	ParseArgs([]string{"-s", "-s"})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get a duplicate option error, got: %v", GetError())
+	}
+
+	// Switches keep their first setting too
+	ParseArgs([]string{"--quiet=false", "--quiet", "-q"})
+	if HasError() || GetBool("quiet") {
+		t.Errorf("Parse() test: First setting of a switch didn't win, got: %v, %v", GetBool("quiet"), GetError())
+	}
+}
+
+// Counters go up for every appearance, including inside combined shortopts, and down for decrements
+func TestCounters(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterCounterOpt("verbose", "verbose", "v", "test usage")
+	regErr = RegisterDecrementOpt("quiet", "verbose", "quiet", "q", "test usage")
+	regErr = RegisterOpt("test", "", "t", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	if RegisterDecrementOpt("bad", "test", "bad", "", "test usage") == nil {
+		t.Error("RegisterDecrementOpt(): Registered a decrement for something that isn't a counter")
+	}
+
+	ParseArgs([]string{"-vvv", "-tv", "--verbose", "-q"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetCount("verbose") != 4 {
+		t.Errorf("Parse() test: Wrong count.  Got: %d.  Expected: 4", GetCount("verbose"))
+	}
+
+	if !GetBool("verbose") || !GetBool("quiet") || !GetBool("test") {
+		t.Error("Parse() test: Didn't get a positive boolean when expecting one")
+	}
+
+	ParseArgs([]string{"-qq"})
+	if GetCount("verbose") != -2 {
+		t.Errorf("Parse() test: Wrong count.  Got: %d.  Expected: -2", GetCount("verbose"))
+	}
+
+	ParseArgs([]string{})
+	if GetCount("verbose") != 0 || GetBool("verbose") {
+		t.Error("Parse() test: Counter was set without being given")
+	}
+}
+
+// Combined shortopts can end in an option which takes a value: tar -xvf archive.tar
+func TestCombinedShortWithVal(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("extract", "", "x", true, false, "test usage")
+	regErr = RegisterOpt("verbose", "", "v", true, false, "test usage")
+	regErr = RegisterOpt("file", "", "f", false, true, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	for _, args := range [][]string{
+		{"-xvf", "archive.tar", "extra"},
+		{"-xvfarchive.tar", "extra"},
+		{"-xvf=archive.tar", "extra"},
+		{"-xv", "-f", "archive.tar", "extra"},
+	} {
+		ParseArgs(args)
+		if HasError() {
+			t.Error("Parse() test: Got a parse error: " + GetError().Error())
+			continue
+		}
+
+		if !GetBool("extract") || !GetBool("verbose") {
+			t.Errorf("Parse() test: Didn't get a positive boolean when expecting one for: %+v", args)
+		}
+
+		if GetString("file") != "archive.tar" {
+			t.Errorf("Parse() test: Didn't get a string val for: %+v.  Got: %s", args, GetString("file"))
+		}
+
+		if len(GetArgs()) != 1 || GetArgs()[0] != "extra" {
+			t.Errorf("Parse() test: Didn't get the right extra args for: %+v, got: %+v", args, GetArgs())
+		}
+	}
+
+	// Nothing left for the value
+	ParseArgs([]string{"-xvf"})
+	if !HasError() {
+		t.Error("Parse() test: Didn't get a parse error when the group's value was missing")
+	}
+}
+
+// Switches can be given explicit values, and negatable ones can be turned off with --no-<long>
+func TestBoolValsAndNegation(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("color", "color", "c", true, false, "test usage")
+	regErr = RegisterOpt("plain", "plain", "p", true, false, "test usage")
+	regErr = RegisterCounterOpt("verbose", "verbose", "v", "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	if err := SetNegatable("color"); err != nil {
+		t.Error("SetNegatable() failed: " + err.Error())
+	}
+
+	if SetNegatable("verbose") == nil {
+		t.Error("SetNegatable() didn't fail for a counter")
+	}
+
+	if RegisterOpt("nocolor", "no-color", "", true, false, "test usage") == nil {
+		t.Error("RegisterOpt(): An option was registered with the same long key as a negation")
+	}
+
+	ParseArgs([]string{"--no-color", "--plain=no"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	val, given := LookupBool("color")
+	if val || !given {
+		t.Errorf("Parse() test: --no-color didn't give an explicit false.  Got: %v, %v", val, given)
+	}
+
+	val, given = LookupBool("plain")
+	if val || !given {
+		t.Errorf("Parse() test: --plain=no didn't give an explicit false.  Got: %v, %v", val, given)
+	}
+
+	ParseArgs([]string{"--color=TRUE", "-p=1"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if !GetBool("color") || !GetBool("plain") {
+		t.Error("Parse() test: Didn't get a positive boolean when expecting one")
+	}
+
+	ParseArgs([]string{})
+	val, given = LookupBool("color")
+	if val || given {
+		t.Errorf("Parse() test: Switch was reported as given when it wasn't.  Got: %v, %v", val, given)
+	}
+
+	// Still errors
+	for _, args := range [][]string{{"--plain=maybe"}, {"--verbose=1"}, {"--no-color=yes"}, {"--no-plain"}} {
+		ParseArgs(args)
+		if !HasError() {
+			t.Errorf("Parse() test: Didn't get a parse error for: %+v", args)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gogetopt
+
+import (
+	"strconv"
+)
+
+// Where an option's value came from
+type SourceKind int
+
+const (
+	// The option wasn't given anywhere and doesn't have a default
+	SOURCE_NONE SourceKind = iota
+	SOURCE_COMMAND_LINE
+	SOURCE_ENV
+	SOURCE_CONFIG
+	SOURCE_DEFAULT
+)
+
+// Describes where an option's value came from, as returned by GetSource().  Which fields are filled
+// in depends on the kind of source.
+type Source struct {
+	Kind SourceKind
+
+	// For SOURCE_COMMAND_LINE, where the option was found in the parsed args (see GetTerminatorIndex()
+	// for how that lines up with os.Args) and the argument exactly as it was typed: "-f", "--file=out",
+	// "-fout", "-xvf", "--no-color" and so on.  When the value was in the following argument, this is
+	// just the option part.
+	Index    int
+	Spelling string
+
+	// For SOURCE_ENV the variable name, for SOURCE_CONFIG the file path
+	Name string
+
+	// For SOURCE_CONFIG, the line in the file
+	Line int
+}
+
+// Describe the source for people, for something like a --print-config option
+func (s Source) String() string {
+	switch s.Kind {
+	case SOURCE_COMMAND_LINE:
+		return "command line: " + s.Spelling + " (argument " + strconv.Itoa(s.Index) + ")"
+	case SOURCE_ENV:
+		return "environment: " + s.Name
+	case SOURCE_CONFIG:
+		return "config file: " + s.Name + ":" + strconv.Itoa(s.Line)
+	case SOURCE_DEFAULT:
+		return "default"
+	}
+	return "not set"
+}
+
+// Get where an option's current value came from.  When an option was given more than once on the
+// command line, this is the appearance whose value was kept.  Options which weren't given anywhere
+// are SOURCE_DEFAULT if they have a default (including Value-backed options) and SOURCE_NONE
+// otherwise.  Only makes sense if Parse() has been called.
+func (p *Parser) GetSource(key string) Source {
+	owner := p.ownerOf(key)
+	src, ok := owner.sources[key]
+	if ok {
+		return src
+	}
+
+	o, ok := owner.opts[key]
+	if ok && (o.hasDefault || o.value != nil) {
+		return Source{Kind: SOURCE_DEFAULT}
+	}
+	return Source{Kind: SOURCE_NONE}
+}
+
+// Get the keys of every registered option, in the order they were registered.  Handy along with
+// GetSource() for listing the full configuration a program ended up with.
+func (p *Parser) GetKeys() []string {
+	keys := make([]string, 0, len(p.order))
+	for _, o := range p.order {
+		keys = append(keys, o.key)
+	}
+	return keys
+}
+
+// Get an option's source from the default parser.  See Parser.GetSource().
+func GetSource(key string) Source {
+	return defaultParser.GetSource(key)
+}
+
+// Get the registered option keys from the default parser.  See Parser.GetKeys().
+func GetKeys() []string {
+	return defaultParser.GetKeys()
+}
+
+//
+// Helpers
+//
+
+// Note that an option's value came from the command line, at args[index]
+func (p *Parser) setCommandLineSource(o *opt, index int) {
+	o.owner.sources[o.key] = Source{Kind: SOURCE_COMMAND_LINE, Index: index, Spelling: p.args[index]}
+}
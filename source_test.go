@@ -0,0 +1,76 @@
+package gogetopt
+
+import (
+	"testing"
+)
+
+// Every option should know where its value came from
+func TestSources(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("file", "file", "f", false, false, "test usage")
+	regErr = RegisterOpt("extract", "", "x", true, false, "test usage")
+	regErr = RegisterOpt("color", "color", "", true, false, "test usage")
+	regErr = RegisterOpt("host", "host", "", false, false, "test usage")
+	regErr = RegisterOpt("port", "port", "", false, false, "test usage")
+	regErr = RegisterOpt("user", "user", "", false, false, "test usage")
+	regErr = RegisterOpt("nothing", "nothing", "", false, false, "test usage")
+	regErr = RegisterOpt("empty", "empty", "", false, false, "test usage")
+	regErr = RegisterValueOpt("level", "level", "", &testLevel{}, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Source test: Testing sources but got reg error: " + regErr.Error())
+	}
+
+	SetNegatable("color")
+	SetDefault("user", "nobody")
+	SetDefault("empty", "")
+	SetEnv("host", "TEST_GOGETOPT_HOST")
+	t.Setenv("TEST_GOGETOPT_HOST", "example.com")
+
+	path := writeTestConfig(t, "test.conf", "\nport = 80\n")
+	if err := LoadConfigFile(path); err != nil {
+		t.Error("LoadConfigFile() failed: " + err.Error())
+	}
+
+	ParseArgs([]string{"extra", "-xfarchive.tar", "--no-color"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	expected := map[string]Source{
+		"file":    {Kind: SOURCE_COMMAND_LINE, Index: 1, Spelling: "-xfarchive.tar"},
+		"extract": {Kind: SOURCE_COMMAND_LINE, Index: 1, Spelling: "-xfarchive.tar"},
+		"color":   {Kind: SOURCE_COMMAND_LINE, Index: 2, Spelling: "--no-color"},
+		"host":    {Kind: SOURCE_ENV, Name: "TEST_GOGETOPT_HOST"},
+		"port":    {Kind: SOURCE_CONFIG, Name: path, Line: 2},
+		"user":    {Kind: SOURCE_DEFAULT},
+		"nothing": {Kind: SOURCE_NONE},
+
+		// Empty defaults are still defaults
+		"empty": {Kind: SOURCE_DEFAULT},
+		"level": {Kind: SOURCE_DEFAULT},
+	}
+
+	for key, src := range expected {
+		if GetSource(key) != src {
+			t.Errorf("Source test: Wrong source for %s.  Got: %+v.  Expected: %+v", key, GetSource(key), src)
+		}
+	}
+
+	if GetSource("port").String() != "config file: "+path+":2" {
+		t.Error("Source test: Wrong description.  Got: " + GetSource("port").String())
+	}
+
+	// The appearance which set the value is the one reported
+	ParseArgs([]string{"--file", "a", "--file=b"})
+	src := GetSource("file")
+	if src.Index != 2 || src.Spelling != "--file=b" {
+		t.Errorf("Source test: Wrong source for a repeated option.  Got: %+v", src)
+	}
+
+	keys := GetKeys()
+	if len(keys) != 9 || keys[0] != "file" || keys[8] != "level" {
+		t.Errorf("Source test: Didn't get the keys in registration order.  Got: %+v", keys)
+	}
+}
@@ -0,0 +1,421 @@
+package gogetopt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// The width usage text is wrapped to unless SetUsageWidth() says otherwise
+	DEFAULT_USAGE_WIDTH int = 80
+
+	// Option columns wider than this put their description on the next line instead of pushing
+	// every description over
+	maxOptColumn int = 30
+
+	// Descriptions always get at least this much room, however narrow the width is
+	minDescColumn int = 20
+)
+
+// Set the program name used in the "Usage:" line.  By default it's the base name of os.Args[0].
+// Commands use the name set on the parser at the top of the tree.
+func (p *Parser) SetProgName(name string) {
+	p.progName = name
+}
+
+// Set what the "Usage:" line shows after the options, like "FILE..." or "SRC DEST".  By default it's
+// "[ARGS...]", or "COMMAND [ARGS...]" for a parser with commands.  An empty string shows nothing.
+func (p *Parser) SetArgsUsage(args string) {
+	p.argsUsage = args
+	p.hasArgsUsage = true
+}
+
+// Set the width usage text is wrapped to.  The default is DEFAULT_USAGE_WIDTH, and 0 or less turns
+// wrapping off.  Commands use the width set on the parser at the top of the tree.
+func (p *Parser) SetUsageWidth(width int) {
+	p.usageWidth = width
+}
+
+// Set the name shown for an option's value in usage, like "FILE" for "--output FILE", in place of its
+// type.  A name in backquotes in the option's usage string does the same thing, the way it does for
+// the standard flag package: "write to `FILE`" shows "--output FILE" and the text "write to FILE".
+func (p *Parser) SetMetavar(key, name string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.metavar = name
+	return nil
+}
+
+// Leave an option out of the usage text and man page, for things like a --generate-man option which
+// only the build uses.  The option still works as normal.
+func (p *Parser) SetHidden(key string) error {
+	o, ok := p.opts[key]
+	if !ok {
+		return errors.New(ERR_NO_OPT + key)
+	}
+
+	o.hidden = true
+	return nil
+}
+
+// Start a section of the usage text.  Options registered after this are listed under the title, like
+// "Network options", instead of under "Options".  Sections are listed in the order their first option
+// was registered, after the options which aren't in one.  An empty title goes back to "Options".
+func (p *Parser) BeginGroup(title string) {
+	p.group = title
+}
+
+// Set text to show between the "Usage:" line and the options, saying what the program does.  For a
+// command this replaces its usage string.
+func (p *Parser) SetDescription(text string) {
+	p.description = text
+}
+
+// Set text to show after everything else in the usage, like examples or where to report bugs.
+func (p *Parser) SetEpilog(text string) {
+	p.epilog = text
+}
+
+// Get the help text for the parser: a "Usage:" synopsis line, then each option in the order it was
+// registered with its description lined up in a column and wrapped to the usage width.  Required
+// options, defaults and environment variables are noted after the description.  For a command, the
+// persistent options it takes from its parents are listed separately, and a parser with commands
+// lists them at the end.
+func (p *Parser) GetUsage() string {
+	root := p.root()
+	own, inherited := p.shownOpts()
+	useStr := "Usage: " + p.synopsis() + "\n"
+
+	description := p.description
+	if description == "" {
+		description = p.cmdUsage
+	}
+
+	if description != "" {
+		useStr += "\n" + wrapText(description, root.usageWidth, 0)
+	}
+
+	titles, groups := groupOpts(own)
+	sections := make(map[string][][2]string)
+	for _, title := range titles {
+		sections[title] = make([][2]string, 0)
+		for _, o := range groups[title] {
+			sections[title] = append(sections[title], [2]string{optColumn(o), optDescription(o)})
+		}
+	}
+
+	titles = append(titles, "Global options")
+	sections["Global options"] = make([][2]string, 0)
+	for _, o := range inherited {
+		sections["Global options"] = append(sections["Global options"], [2]string{optColumn(o), optDescription(o)})
+	}
+
+	titles = append(titles, "Commands")
+	sections["Commands"] = make([][2]string, 0)
+	for _, cmd := range p.commandOrder {
+		sections["Commands"] = append(sections["Commands"], [2]string{cmd.name, cmd.cmdUsage})
+	}
+
+	// Everything is lined up on one column so the sections match
+	col := 0
+	for _, rows := range sections {
+		for _, row := range rows {
+			if len(row[0]) > col && len(row[0]) <= maxOptColumn {
+				col = len(row[0])
+			}
+		}
+	}
+
+	// Two spaces of indent before, and at least two spaces between the columns
+	col += 4
+
+	for _, title := range titles {
+		useStr += usageSection(title, sections[title], col, root.usageWidth)
+	}
+
+	if p.epilog != "" {
+		useStr += "\n" + wrapText(p.epilog, root.usageWidth, 0)
+	}
+	return useStr
+}
+
+// Set the program name on the default parser.  See Parser.SetProgName().
+func SetProgName(name string) {
+	defaultParser.SetProgName(name)
+}
+
+// Set the synopsis args on the default parser.  See Parser.SetArgsUsage().
+func SetArgsUsage(args string) {
+	defaultParser.SetArgsUsage(args)
+}
+
+// Set the usage width on the default parser.  See Parser.SetUsageWidth().
+func SetUsageWidth(width int) {
+	defaultParser.SetUsageWidth(width)
+}
+
+// Set an option's metavar on the default parser.  See Parser.SetMetavar().
+func SetMetavar(key, name string) error {
+	return defaultParser.SetMetavar(key, name)
+}
+
+// Hide an option on the default parser.  See Parser.SetHidden().
+func SetHidden(key string) error {
+	return defaultParser.SetHidden(key)
+}
+
+// Start a usage section on the default parser.  See Parser.BeginGroup().
+func BeginGroup(title string) {
+	defaultParser.BeginGroup(title)
+}
+
+// Set the description on the default parser.  See Parser.SetDescription().
+func SetDescription(text string) {
+	defaultParser.SetDescription(text)
+}
+
+// Set the epilog on the default parser.  See Parser.SetEpilog().
+func SetEpilog(text string) {
+	defaultParser.SetEpilog(text)
+}
+
+//
+// Helpers
+//
+
+// Get the parser at the top of the command tree
+func (p *Parser) root() *Parser {
+	r := p
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// Get the program name for the synopsis line
+func (p *Parser) getProgName() string {
+	if p.progName != "" {
+		return p.progName
+	}
+
+	if len(os.Args) > 0 {
+		return filepath.Base(os.Args[0])
+	}
+	return ""
+}
+
+// Get the name the program is run by, with the command path for a command: "prog remote add"
+func (p *Parser) usageName() string {
+	name := p.root().getProgName()
+	if p.parent != nil {
+		name += " " + p.GetCommandPath()
+	}
+	return name
+}
+
+// Get the synopsis of how the program is run, like "prog deploy [OPTIONS] [ARGS...]"
+func (p *Parser) synopsis() string {
+	synopsis := p.usageName()
+
+	own, inherited := p.shownOpts()
+	if len(own) > 0 || len(inherited) > 0 {
+		synopsis += " [OPTIONS]"
+	}
+
+	args := p.getArgsUsage()
+	if args != "" {
+		synopsis += " " + args
+	}
+	return synopsis
+}
+
+// Get the options which should be shown to people, in registration order: the parser's own, and the
+// persistent ones it takes from its parents
+func (p *Parser) shownOpts() (own []*opt, inherited []*opt) {
+	own = make([]*opt, 0)
+	for _, o := range p.order {
+		if !o.hidden {
+			own = append(own, o)
+		}
+	}
+
+	inherited = make([]*opt, 0)
+	for _, o := range p.inheritedOpts() {
+		if !o.hidden {
+			inherited = append(inherited, o)
+		}
+	}
+	return own, inherited
+}
+
+// Sort options into their groups.  Options not in a group come first under "Options", then each group
+// in the order it was first used.
+func groupOpts(opts []*opt) (titles []string, groups map[string][]*opt) {
+	titles = []string{"Options"}
+	groups = map[string][]*opt{"Options": make([]*opt, 0)}
+	for _, o := range opts {
+		title := o.group
+		if title == "" {
+			title = "Options"
+		}
+
+		_, ok := groups[title]
+		if !ok {
+			titles = append(titles, title)
+		}
+		groups[title] = append(groups[title], o)
+	}
+	return titles, groups
+}
+
+// Get what the synopsis line shows after the options
+func (p *Parser) getArgsUsage() string {
+	if p.hasArgsUsage {
+		return p.argsUsage
+	}
+
+	if len(p.commandOrder) > 0 {
+		return "COMMAND [ARGS...]"
+	}
+	return "[ARGS...]"
+}
+
+// Get the option column for a single option, like "-f, --file <string>".  Options without a short
+// key are indented so their long keys line up with the others.
+func optColumn(o *opt) string {
+	colStr := "    "
+	if o.short != "" {
+		colStr = "-" + o.short
+		if o.long != "" {
+			colStr += ", "
+		}
+	}
+
+	if o.negation != nil {
+		colStr += "--[no-]" + o.long
+	} else if o.long != "" {
+		colStr += "--" + o.long
+	}
+
+	if o.isOptional {
+		colStr += "[=" + valuePlaceholder(o) + "]"
+	} else if !o.isBool {
+		colStr += " " + valuePlaceholder(o)
+	}
+	return colStr
+}
+
+// Get the description for a single option: its usage followed by any notes about it
+func optDescription(o *opt) string {
+	_, desc := unquoteUsage(o.usage)
+
+	notes := make([]string, 0)
+	if o.required {
+		notes = append(notes, "(required)")
+	}
+
+	def := defaultDisplay(o)
+	if def != "" {
+		notes = append(notes, "(default: "+def+")")
+	}
+
+	if len(o.envVars) > 0 {
+		notes = append(notes, "(env: "+strings.Join(o.envVars, ", ")+")")
+	}
+
+	if len(notes) > 0 {
+		if desc != "" {
+			desc += " "
+		}
+		desc += strings.Join(notes, " ")
+	}
+	return desc
+}
+
+// Lay out a titled section of two-column rows, with the second column starting at col and wrapped to
+// width.  Empty sections come out as nothing at all.
+func usageSection(title string, rows [][2]string, col int, width int) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	descWidth := 0
+	if width > 0 {
+		descWidth = width - col
+		if descWidth < minDescColumn {
+			descWidth = minDescColumn
+		}
+	}
+
+	useStr := "\n" + title + ":\n"
+	for _, row := range rows {
+		line := "  " + row[0]
+		if row[1] == "" {
+			useStr += line + "\n"
+			continue
+		}
+
+		if len(line)+2 > col {
+			line += "\n" + strings.Repeat(" ", col)
+		} else {
+			line += strings.Repeat(" ", col-len(line))
+		}
+
+		useStr += line + strings.TrimPrefix(wrapText(row[1], descWidth, col), strings.Repeat(" ", col))
+	}
+	return useStr
+}
+
+// Wrap text to a width, with every line indented by indent spaces and ending in a newline.  Line breaks
+// already in the text are kept, and words longer than the width get a line to themselves.  A width of
+// 0 or less doesn't wrap at all.
+func wrapText(text string, width int, indent int) string {
+	pad := strings.Repeat(" ", indent)
+	wrapped := ""
+
+	for _, para := range strings.Split(text, "\n") {
+		words := strings.Fields(para)
+		if width <= 0 || len(words) == 0 {
+			wrapped += pad + strings.TrimSpace(para) + "\n"
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			if line != "" && len(line)+1+len(word) > width {
+				wrapped += pad + line + "\n"
+				line = ""
+			}
+
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		wrapped += pad + line + "\n"
+	}
+	return wrapped
+}
+
+// Find a name in backquotes in a usage string, for the value's placeholder.  Returns the name, or ""
+// if there isn't one, and the usage with the backquotes taken out.
+func unquoteUsage(usage string) (name string, unquoted string) {
+	start := strings.Index(usage, "`")
+	if start < 0 {
+		return "", usage
+	}
+
+	end := strings.Index(usage[start+1:], "`")
+	if end < 0 {
+		return "", usage
+	}
+	end += start + 1
+
+	name = usage[start+1 : end]
+	return name, usage[:start] + name + usage[end+1:]
+}
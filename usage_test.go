@@ -0,0 +1,129 @@
+package gogetopt
+
+import (
+	"testing"
+)
+
+// Usage lists options in registration order, lined up and wrapped
+func TestUsage(t *testing.T) {
+	p := NewParser()
+	p.SetProgName("prog")
+	p.SetArgsUsage("FILE...")
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "Print more about what's going on while the program runs, which helps when debugging")
+	regErr = p.RegisterOpt("config", "config", "c", false, true, "Config file")
+	regErr = p.RegisterOpt("name", "name", "", false, false, "")
+	regErr = p.RegisterTypedOpt("count", "count", "n", TYPE_INT, false, "How many")
+	regErr = p.RegisterOptionalOpt("color", "color", "", "always", false, "When to use color")
+	regErr = p.RegisterOpt("long", "a-really-long-option-name", "", false, false, "Too long to line up")
+	regErr = p.RegisterOpt("short", "", "s", true, false, "Short only")
+
+	if regErr != nil {
+		t.Error("GetUsage() test: Got reg error: " + regErr.Error())
+	}
+
+	p.SetDefault("name", "bob")
+	p.SetEnv("config", "TEST_GOGETOPT_CONFIG")
+
+	expected := `Usage: prog [OPTIONS] FILE...
+
+Options:
+  -v, --verbose          Print more about what's going on while the program
+                         runs, which helps when debugging
+  -c, --config <value>   Config file (required) (env: TEST_GOGETOPT_CONFIG)
+      --name <value>     (default: bob)
+  -n, --count <int>      How many
+      --color[=<value>]  When to use color
+      --a-really-long-option-name <value>
+                         Too long to line up
+  -s                     Short only
+`
+
+	// Same output every time, not just when the map happens to come out in order
+	for i := 0; i < 10; i++ {
+		usage := p.GetUsage()
+		if usage != expected {
+			t.Fatal("GetUsage() test: Didn't get the expected usage.  Got:\n" + usage)
+		}
+	}
+
+	// Without wrapping
+	p.SetUsageWidth(0)
+	p.SetArgsUsage("")
+	p.ClearAll()
+	p.RegisterOpt("verbose", "verbose", "v", true, false, "Print more about what's going on while the program runs, which helps when debugging")
+
+	expected = `Usage: prog [OPTIONS]
+
+Options:
+  -v, --verbose  Print more about what's going on while the program runs, which helps when debugging
+`
+
+	usage := p.GetUsage()
+	if usage != expected {
+		t.Error("GetUsage() test: Didn't get the expected usage without wrapping.  Got:\n" + usage)
+	}
+}
+
+// Long words get a line of their own and line breaks in the text are kept
+func TestWrapText(t *testing.T) {
+	wrapped := wrapText("one two three\nfour averyveryverylongword five", 10, 2)
+	expected := "  one two\n  three\n  four\n  averyveryverylongword\n  five\n"
+	if wrapped != expected {
+		t.Error("wrapText() test: Didn't get the expected text.  Got:\n" + wrapped)
+	}
+}
+
+// Metavars, groups, description and epilog
+func TestUsageGroups(t *testing.T) {
+	p := NewParser()
+	p.SetProgName("prog")
+	p.SetDescription("Copies things from one place to another.")
+	p.SetEpilog("Report bugs to the issue tracker.")
+
+	var regErr error
+	regErr = p.RegisterOpt("verbose", "verbose", "v", true, false, "Say more")
+	p.BeginGroup("Input options")
+	regErr = p.RegisterOpt("input", "input", "i", false, false, "Read from `FILE`")
+	regErr = p.RegisterTypedOpt("jobs", "jobs", "j", TYPE_INT, false, "Jobs to run")
+	p.BeginGroup("Network options")
+	regErr = p.RegisterOpt("host", "host", "", false, false, "Host to connect to")
+	p.BeginGroup("")
+	regErr = p.RegisterOpt("quiet", "quiet", "q", true, false, "Say less")
+
+	if regErr != nil {
+		t.Error("GetUsage() test: Got reg error: " + regErr.Error())
+	}
+
+	if p.SetMetavar("jobs", "N") != nil {
+		t.Error("SetMetavar() failed for a registered key")
+	}
+
+	if p.SetMetavar("nope", "N") == nil {
+		t.Error("SetMetavar() didn't fail for an unregistered key")
+	}
+
+	expected := `Usage: prog [OPTIONS] [ARGS...]
+
+Copies things from one place to another.
+
+Options:
+  -v, --verbose       Say more
+  -q, --quiet         Say less
+
+Input options:
+  -i, --input FILE    Read from FILE
+  -j, --jobs N        Jobs to run
+
+Network options:
+      --host <value>  Host to connect to
+
+Report bugs to the issue tracker.
+`
+
+	usage := p.GetUsage()
+	if usage != expected {
+		t.Error("GetUsage() test: Didn't get the expected usage.  Got:\n" + usage)
+	}
+}
@@ -0,0 +1,239 @@
+package gogetopt
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// The kind of value an option takes.  Values are always available as strings through GetString(), but
+// typed options are also converted while parsing so a bad value is caught as a parse error.
+type OptType int
+
+const (
+	TYPE_STRING OptType = iota
+	TYPE_INT
+	TYPE_INT64
+	TYPE_UINT
+	TYPE_FLOAT64
+	TYPE_DURATION
+	TYPE_BOOL
+)
+
+// Value is the interface for options with a user-defined type, the same one the standard flag package
+// uses.  Set() is called with the value every time the option is given, and an error from it is a
+// parse error for that option.  String() should return the current value, and is shown in the usage
+// text as the option's default.
+type Value interface {
+	Set(string) error
+	String() string
+}
+
+// Register an option which takes a value of a particular type.  The value is converted during parsing
+// and can be read back with the getter for that type (GetInt() for TYPE_INT and so on, GetBool() for
+// TYPE_BOOL).  Anything which can't be converted is a parse error naming the option and the type.
+// Integers can be given in decimal, hex (0x) or octal (0o), the same as the standard flag package.
+func (p *Parser) RegisterTypedOpt(key, long, short string, valType OptType, isReq bool, usage string) error {
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.valType = valType
+	o.required = isReq
+	o.usage = usage
+
+	return p.register(o)
+}
+
+// Register an option backed by a user-supplied Value.  Every time the option is given, the value is
+// passed to val.Set() - unless the option's duplicate policy throws it away (DUP_FIRST_WINS) or rejects
+// it (DUP_ERROR).  The Value is never reset by the parser, so it keeps whatever state it had from
+// before parsing.  GetString() still returns the last raw value.
+func (p *Parser) RegisterValueOpt(key, long, short string, val Value, isReq bool, usage string) error {
+	o := new(opt)
+	o.key = key
+	o.long = stripDashes(long)
+	o.short = stripDashes(short)
+	o.value = val
+	o.required = isReq
+	o.usage = usage
+
+	return p.register(o)
+}
+
+// Get an int value for a TYPE_INT option key.  Returns the option's default if it wasn't given, or 0
+// if there's no default or it isn't a TYPE_INT option.  Only makes sense if Parse() has been called.
+func (p *Parser) GetInt(key string) int {
+	val, _ := p.typedVal(key).(int)
+	return val
+}
+
+// Get an int64 value for a TYPE_INT64 option key.  Returns the option's default if it wasn't given, or
+// 0 if there's no default or it isn't a TYPE_INT64 option.  Only makes sense if Parse() has been called.
+func (p *Parser) GetInt64(key string) int64 {
+	val, _ := p.typedVal(key).(int64)
+	return val
+}
+
+// Get a uint value for a TYPE_UINT option key.  Returns the option's default if it wasn't given, or 0
+// if there's no default or it isn't a TYPE_UINT option.  Only makes sense if Parse() has been called.
+func (p *Parser) GetUint(key string) uint {
+	val, _ := p.typedVal(key).(uint)
+	return val
+}
+
+// Get a float64 value for a TYPE_FLOAT64 option key.  Returns the option's default if it wasn't given,
+// or 0 if there's no default or it isn't a TYPE_FLOAT64 option.  Only makes sense if Parse() has been called.
+func (p *Parser) GetFloat64(key string) float64 {
+	val, _ := p.typedVal(key).(float64)
+	return val
+}
+
+// Get a duration value for a TYPE_DURATION option key.  Durations are given the way
+// time.ParseDuration() expects them, like "1m30s".  Returns the option's default if it wasn't given,
+// or 0 if there's no default or it isn't a TYPE_DURATION option.  Only makes sense if Parse() has been called.
+func (p *Parser) GetDuration(key string) time.Duration {
+	val, _ := p.typedVal(key).(time.Duration)
+	return val
+}
+
+// Register a typed option on the default parser.  See Parser.RegisterTypedOpt().
+func RegisterTypedOpt(key, long, short string, valType OptType, isReq bool, usage string) error {
+	return defaultParser.RegisterTypedOpt(key, long, short, valType, isReq, usage)
+}
+
+// Register a Value-backed option on the default parser.  See Parser.RegisterValueOpt().
+func RegisterValueOpt(key, long, short string, val Value, isReq bool, usage string) error {
+	return defaultParser.RegisterValueOpt(key, long, short, val, isReq, usage)
+}
+
+// Get an int value from the default parser.  See Parser.GetInt().
+func GetInt(key string) int {
+	return defaultParser.GetInt(key)
+}
+
+// Get an int64 value from the default parser.  See Parser.GetInt64().
+func GetInt64(key string) int64 {
+	return defaultParser.GetInt64(key)
+}
+
+// Get a uint value from the default parser.  See Parser.GetUint().
+func GetUint(key string) uint {
+	return defaultParser.GetUint(key)
+}
+
+// Get a float64 value from the default parser.  See Parser.GetFloat64().
+func GetFloat64(key string) float64 {
+	return defaultParser.GetFloat64(key)
+}
+
+// Get a duration value from the default parser.  See Parser.GetDuration().
+func GetDuration(key string) time.Duration {
+	return defaultParser.GetDuration(key)
+}
+
+//
+// Helpers
+//
+
+// Get the name used for a type in error messages and usage text
+func typeName(valType OptType) string {
+	switch valType {
+	case TYPE_INT:
+		return "int"
+	case TYPE_INT64:
+		return "int64"
+	case TYPE_UINT:
+		return "uint"
+	case TYPE_FLOAT64:
+		return "float"
+	case TYPE_DURATION:
+		return "duration"
+	case TYPE_BOOL:
+		return "bool"
+	}
+	return "value"
+}
+
+// Get the placeholder shown for an option's value in the usage text: its metavar, a name in backquotes
+// in its usage string, or its type
+func valuePlaceholder(o *opt) string {
+	if o.metavar != "" {
+		return o.metavar
+	}
+
+	name, _ := unquoteUsage(o.usage)
+	if name != "" {
+		return name
+	}
+	return "<" + typeName(o.valType) + ">"
+}
+
+// Get the converted value of a typed option, falling back on its default if it wasn't given.  Returns
+// nil if there's neither.
+func (p *Parser) typedVal(key string) interface{} {
+	owner := p.ownerOf(key)
+	val, ok := owner.typedVals[key]
+	if ok {
+		return val
+	}
+
+	o, ok := owner.opts[key]
+	if ok && o.hasDefault {
+		return o.defConverted
+	}
+	return nil
+}
+
+// Get what the usage text shows as an option's default, "" for none.  For Value-backed options this
+// is whatever the Value holds.
+func defaultDisplay(o *opt) string {
+	if o.hasDefault {
+		return o.defVal
+	}
+
+	if o.value != nil {
+		return o.value.String()
+	}
+	return ""
+}
+
+// Convert a value to the option's type.  Plain string options get the string back as is.  The error
+// names the option and the type that was expected.
+func convertVal(o *opt, val string) (interface{}, error) {
+	var converted interface{}
+	var err error
+
+	switch o.valType {
+	case TYPE_STRING:
+		return val, nil
+	case TYPE_INT:
+		var i int64
+		i, err = strconv.ParseInt(val, 0, strconv.IntSize)
+		converted = int(i)
+	case TYPE_INT64:
+		converted, err = strconv.ParseInt(val, 0, 64)
+	case TYPE_UINT:
+		var u uint64
+		u, err = strconv.ParseUint(val, 0, strconv.IntSize)
+		converted = uint(u)
+	case TYPE_FLOAT64:
+		converted, err = strconv.ParseFloat(val, 64)
+	case TYPE_DURATION:
+		converted, err = time.ParseDuration(val)
+	case TYPE_BOOL:
+		var ok bool
+		converted, ok = parseBoolVal(val)
+		if !ok {
+			err = errors.New("not a boolean")
+		}
+	}
+
+	if err != nil {
+		e := newParseError(KIND_INVALID_VAL, o, ERR_INVALID_VAL+optDisplayName(o)+" expects "+typeName(o.valType)+", got: "+val)
+		e.Err = err
+		return nil, e
+	}
+
+	return converted, nil
+}
@@ -0,0 +1,206 @@
+package gogetopt
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Values for typed options are converted while parsing
+func TestTypedVals(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterTypedOpt("jobs", "jobs", "j", TYPE_INT, false, "test usage")
+	regErr = RegisterTypedOpt("size", "size", "", TYPE_INT64, false, "test usage")
+	regErr = RegisterTypedOpt("count", "count", "", TYPE_UINT, false, "test usage")
+	regErr = RegisterTypedOpt("ratio", "ratio", "", TYPE_FLOAT64, false, "test usage")
+	regErr = RegisterTypedOpt("timeout", "timeout", "", TYPE_DURATION, false, "test usage")
+	regErr = RegisterTypedOpt("enable", "enable", "", TYPE_BOOL, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	ParseArgs([]string{"-j4", "--size=0x10", "--count", "7", "--ratio", "0.5", "--timeout=1m30s", "--enable", "yes"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetInt("jobs") != 4 {
+		t.Errorf("Parse() test: Wrong int val.  Got: %d.  Expected: 4", GetInt("jobs"))
+	}
+
+	if GetInt64("size") != 16 {
+		t.Errorf("Parse() test: Wrong int64 val.  Got: %d.  Expected: 16", GetInt64("size"))
+	}
+
+	if GetUint("count") != 7 {
+		t.Errorf("Parse() test: Wrong uint val.  Got: %d.  Expected: 7", GetUint("count"))
+	}
+
+	if GetFloat64("ratio") != 0.5 {
+		t.Errorf("Parse() test: Wrong float val.  Got: %f.  Expected: 0.5", GetFloat64("ratio"))
+	}
+
+	if GetDuration("timeout") != 90*time.Second {
+		t.Errorf("Parse() test: Wrong duration val.  Got: %v.  Expected: 1m30s", GetDuration("timeout"))
+	}
+
+	if !GetBool("enable") {
+		t.Error("Parse() test: Didn't get a positive boolean when expecting one")
+	}
+
+	// The raw string is still there
+	if GetString("jobs") != "4" {
+		t.Error("Parse() test: Didn't get the raw string val for a typed option.  Got: " + GetString("jobs"))
+	}
+
+	// Wrong getter for the type gives the zero value
+	if GetInt64("jobs") != 0 {
+		t.Error("Parse() test: Got a value from the wrong typed getter")
+	}
+}
+
+// Bad values for typed options are parse errors naming the option and the type
+func TestTypedValErrors(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterTypedOpt("jobs", "jobs", "j", TYPE_INT, false, "test usage")
+	regErr = RegisterTypedOpt("count", "count", "", TYPE_UINT, false, "test usage")
+	regErr = RegisterTypedOpt("timeout", "timeout", "", TYPE_DURATION, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	cases := map[string][]string{
+		"-j or --jobs expects int, got: four": {"--jobs", "four"},
+		"--count expects uint, got: -1":       {"--count=-1"},
+		"--timeout expects duration, got: 5":  {"--timeout", "5"},
+	}
+
+	for msg, args := range cases {
+		expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_INVALID_VAL+msg) + "$")
+
+		ParseArgs(args)
+		if !HasError() || !expr.MatchString(GetError().Error()) {
+			t.Errorf("Parse() test: Didn't get the right invalid value error for %+v, got: %v", args, GetError())
+		}
+	}
+}
+
+// A Value for testing: a log level which only accepts a few names
+type testLevel struct {
+	level string
+	sets  int
+}
+
+func (l *testLevel) Set(val string) error {
+	switch val {
+	case "debug", "info", "error":
+		l.level = val
+		l.sets++
+		return nil
+	}
+	return errors.New("unknown level " + val)
+}
+
+func (l *testLevel) String() string {
+	return l.level
+}
+
+// Options backed by a Value get Set() called for every appearance
+func TestValueOpts(t *testing.T) {
+	ClearAll()
+	level := &testLevel{level: "info"}
+
+	regErr := RegisterValueOpt("level", "level", "l", level, false, "test usage")
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	if !strings.Contains(GetUsage(), "(default: info)") {
+		t.Error("GetUsage() test: Value's string form wasn't shown as the default.  Got: " + GetUsage())
+	}
+
+	ParseArgs([]string{"--level", "debug", "-lerror"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if level.level != "error" || level.sets != 2 {
+		t.Errorf("Parse() test: Value wasn't set for every appearance.  Got: %s after %d sets", level.level, level.sets)
+	}
+
+	expr := regexp.MustCompile("^" + regexp.QuoteMeta(ERR_INVALID_VAL+"-l or --level: unknown level loud") + "$")
+
+	ParseArgs([]string{"--level=loud"})
+	if !HasError() || !expr.MatchString(GetError().Error()) {
+		t.Errorf("Parse() test: Didn't get the right invalid value error, got: %v", GetError())
+	}
+}
+
+// Defaults are returned for absent options without counting as given
+func TestDefaults(t *testing.T) {
+	ClearAll()
+	var regErr error
+	regErr = RegisterOpt("output", "output", "o", false, false, "test usage")
+	regErr = RegisterOpt("empty", "empty", "", false, false, "test usage")
+	regErr = RegisterTypedOpt("jobs", "jobs", "j", TYPE_INT, false, "test usage")
+	regErr = RegisterOpt("switch", "switch", "", true, false, "test usage")
+
+	if regErr != nil {
+		t.Error("Parse() test: Testing opt parsing but got reg error: " + regErr.Error())
+	}
+
+	if err := SetDefault("output", "out.txt"); err != nil {
+		t.Error("SetDefault() failed: " + err.Error())
+	}
+
+	if err := SetDefault("jobs", "2"); err != nil {
+		t.Error("SetDefault() failed: " + err.Error())
+	}
+
+	if SetDefault("jobs", "two") == nil {
+		t.Error("SetDefault() didn't fail for a default which doesn't match the option's type")
+	}
+
+	if SetDefault("switch", "yes") == nil {
+		t.Error("SetDefault() didn't fail for a switch")
+	}
+
+	if !strings.Contains(GetUsage(), "(default: out.txt)") {
+		t.Error("GetUsage() test: Default wasn't shown.  Got: " + GetUsage())
+	}
+
+	ParseArgs([]string{})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	if GetString("output") != "out.txt" || GetInt("jobs") != 2 {
+		t.Errorf("Parse() test: Didn't get defaults.  Got: %s, %d", GetString("output"), GetInt("jobs"))
+	}
+
+	val, given := Lookup("output")
+	if val != "out.txt" || given {
+		t.Errorf("Parse() test: Default was reported as given.  Got: %s, %v", val, given)
+	}
+
+	val, given = Lookup("empty")
+	if val != "" || given {
+		t.Errorf("Parse() test: Absent option without a default was reported as given.  Got: %s, %v", val, given)
+	}
+
+	ParseArgs([]string{"-o", "other.txt", "-j8"})
+	if HasError() {
+		t.Error("Parse() test: Got a parse error: " + GetError().Error())
+	}
+
+	val, given = Lookup("output")
+	if val != "other.txt" || !given || GetInt("jobs") != 8 {
+		t.Errorf("Parse() test: Given values didn't override defaults.  Got: %s, %v, %d", val, given, GetInt("jobs"))
+	}
+}